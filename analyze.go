@@ -0,0 +1,1162 @@
+package main
+
+import (
+        "errors"
+        "fmt"
+        "io"
+        "os"
+        "sort"
+        "strings"
+        "sync"
+        "time"
+)
+
+// runAnalyze is the analyze subcommand: it filters the logs, sends them to the
+// AI service in chunks and writes the combined summary. It returns the
+// process exit code reflecting how many chunks failed.
+func runAnalyze() int {
+        logInfof("Log analyzer starting...")
+        started := time.Now()
+
+        tokenizer, err := newTokenizer(cfg.Tokenizer)
+        if err != nil {
+                logFatalf("Invalid -tokenizer: %v", err)
+        }
+        minSeverity, ok := severityNames[strings.ToLower(cfg.MinLevel)]
+        if !ok {
+                logFatalf("Invalid -min-level %q (want debug, info, warn, error or fatal)", cfg.MinLevel)
+        }
+        includePatterns, err := compilePatterns(cfg.Include)
+        if err != nil {
+                logFatalf("Invalid -include: %v", err)
+        }
+        excludePatterns, err := compilePatterns(cfg.Exclude)
+        if err != nil {
+                logFatalf("Invalid -exclude: %v", err)
+        }
+        var format *lineFormat
+        if cfg.LineFormat != "" {
+                if format, err = newLineFormat(cfg.LineFormat); err != nil {
+                        logFatalf("Invalid -line-format: %v", err)
+                }
+        }
+        if cfg.DropHealthchecks {
+                patterns := []string(cfg.HealthcheckPatterns)
+                if len(patterns) == 0 {
+                        patterns = defaultHealthcheckPatterns
+                }
+                if healthcheckPatterns, err = compilePatterns(patterns); err != nil {
+                        logFatalf("Invalid -healthcheck-pattern: %v", err)
+                }
+        }
+
+        filter := &lineFilter{
+                MinSeverity: minSeverity,
+                Include:     includePatterns,
+                Exclude:     excludePatterns,
+                JSONLogs:    cfg.JSONLogs,
+                Logfmt:      cfg.Logfmt,
+                TSField:     cfg.TSField,
+                Fields:      cfg.Fields,
+
+                LineFormat:    format,
+                DropUnmatched: cfg.DropUnmatched,
+
+                MaxLineLength: cfg.MaxLineLength,
+                LastN:         cfg.LastN,
+
+                SampleSize:   cfg.SampleSize,
+                KeepUnparsed: cfg.AnalyzeUnparsed,
+
+                ContextLines: cfg.ContextLines,
+
+                Process:      cfg.Process,
+                PID:          cfg.PID,
+                KeepUntagged: cfg.KeepUntagged,
+
+                FirstLine: 1,
+        }
+        if cfg.Serve != "" {
+                return serveAnalysis(filter, tokenizer)
+        }
+
+        // Calculate the time range to analyze before touching the log file
+        startTime, endTime, err := resolveWindow(time.Now().In(timeZone))
+        if err != nil {
+                logFatalf("Invalid time window: %v", err)
+        }
+        var state *runState
+        resumedAfter = time.Time{}
+        openedLogs = map[string]os.FileInfo{}
+        if cfg.Follow {
+                // Recorded as the files are read, for following to start there
+                logOffsets, logHeads = map[string]int64{}, map[string]fileHead{}
+        }
+        if cfg.StateFile != "" {
+                state = loadRunState(cfg.StateFile)
+                logOffsets, logHeads = map[string]int64{}, map[string]fileHead{}
+                if state != nil {
+                        for path, offset := range state.Offsets {
+                                logOffsets[path] = offset
+                        }
+                        for path, head := range state.Heads {
+                                logHeads[path] = head
+                        }
+                        if !state.LastTime.IsZero() && cfg.Since == "" && state.LastTime.Before(endTime) {
+                                // Each input starts at or just after it, see resumeStart
+                                startTime, resumedAfter = state.LastTime, state.LastTime
+                                logInfof("Continuing from the newest line of the last run (-state-file %s)", cfg.StateFile)
+                        }
+                }
+        }
+        // After the state file, whose last run may be long ago
+        if cfg.LastN == 0 {
+                if err := checkWindowSize(startTime, endTime); err != nil {
+                        logFatalf("Refusing to analyze: %v", err)
+                }
+        }
+        filter.Start, filter.End = startTime, endTime
+
+        if cfg.LastN > 0 {
+                logInfof("Taking the last %d lines of each log, ignoring timestamps", cfg.LastN)
+        } else {
+                logInfof("Filtering logs from %s to %s (%s)", startTime.Format(time.RFC3339), endTime.Format(time.RFC3339), endTime.Sub(startTime).Round(time.Second))
+        }
+
+        // Filter log entries for the time window
+        logInfof("Filtering logs for the time window...")
+        var entries []logEntry
+        if cfg.Journal {
+                if !resumedAfter.IsZero() {
+                        // The journal is read from the top, with no offset to resume from
+                        filter.Start = resumedAfter.Add(time.Nanosecond)
+                }
+                entries, err = readJournal(filter, filter.Start, endTime)
+                filter.Start = startTime
+        } else if entries, err = readLogFiles(filter); err != nil {
+                err = fmt.Errorf("Failed to read log file: %v", err)
+        }
+        if err != nil {
+                if cfg.Every == 0 {
+                        logFatalf("%v", err)
+                }
+                // Only this pass fails; the logs may be back for the next one
+                logErrorf("%v", err)
+                return exitFailed
+        }
+
+        if cfg.LastN > 0 {
+                // The summary's window is whatever span the taken lines cover
+                filter.Start, filter.End = entrySpan(entries, startTime, endTime)
+                logInfof("Took %d log lines from the end of the logs", filter.InWindow)
+        } else {
+                logInfof("Found %d log lines in the time window", filter.InWindow)
+        }
+        if filter.ProcessDropped > 0 {
+                logInfof("Dropped %d lines from other processes by -process/-pid", filter.ProcessDropped)
+        }
+        if filter.SeverityDropped > 0 {
+                logInfof("Dropped %d lines below severity %s", filter.SeverityDropped, cfg.MinLevel)
+        }
+        if filter.ContextKept > 0 {
+                logInfof("Kept %d lines below severity %s as context", filter.ContextKept, cfg.MinLevel)
+        }
+        if filter.PatternDropped > 0 {
+                logInfof("Dropped %d lines by -include/-exclude patterns", filter.PatternDropped)
+        }
+        if filter.Malformed > 0 {
+                logWarnf("Skipped %d lines that were not valid JSON", filter.Malformed)
+        }
+        if filter.Sanitized > 0 {
+                logInfof("Cleaned up %d lines with a byte order mark or invalid UTF-8", filter.Sanitized)
+        }
+        if filter.Unmatched > 0 {
+                if cfg.DropUnmatched {
+                        logInfof("Dropped %d lines not matching -line-format", filter.Unmatched)
+                } else {
+                        logWarnf("Read %d lines not matching -line-format as plain text", filter.Unmatched)
+                }
+        }
+        if filter.NotLogfmt > 0 {
+                logWarnf("Passed %d lines that were not logfmt through unchanged", filter.NotLogfmt)
+        }
+        if filter.LongLines > 0 {
+                logInfof("Truncated %d lines longer than %d bytes", filter.LongLines, cfg.MaxLineLength)
+        }
+        if cfg.Strict {
+                checkDropRatio(filter)
+        }
+
+        var baseline *baselineWindow
+        if cfg.Compare {
+                baseline = readBaseline(filter)
+        }
+        code := analyzeEntries(entries, filter, tokenizer, started, baseline)
+        saveRedactionMap()
+        if cfg.StateFile != "" && !cfg.DryRun && code == exitOK {
+                saveRunState(cfg.StateFile, nextRunState(state, entries))
+        }
+        if cfg.Follow && !cfg.DryRun && !interrupted() {
+                return followLogs(entries, filter, tokenizer)
+        }
+        return code
+}
+
+// checkDropRatio fails the run for -strict when more than -max-drop-ratio of
+// the lines were dropped as unparseable, showing a sample of them
+func checkDropRatio(filter *lineFilter) {
+        ratio := filter.dropRatio()
+        if ratio <= cfg.MaxDropRatio {
+                return
+        }
+        for _, line := range filter.Unparsed {
+                logErrorf("Unparsed: %s", line)
+        }
+        logFatalf("-strict: %d of %d lines (%.1f%%) had no usable timestamp, more than -max-drop-ratio %g; check -ts-layout, -json-logs or -logfmt",
+                filter.unparsedLines(), filter.NonEmpty, ratio*100, cfg.MaxDropRatio)
+}
+
+// readLogFiles filters the -log files, skipping any that can't be opened. It
+// fails if none can be read or ssh can't reach a remote log.
+func readLogFiles(filter *lineFilter) ([]logEntry, error) {
+        var entries []logEntry
+        readable := 0
+        defer func(start time.Time) { filter.Start = start }(filter.Start)
+        for _, path := range cfg.LogPaths {
+                if !resumedAfter.IsZero() {
+                        filter.Start = resumeStart(path)
+                }
+                // Each file is streamed line by line rather than loaded whole
+                var logFile io.ReadCloser
+                var err error
+                // Line numbers are only right when reading starts at the top of the file
+                filter.FirstLine = 1
+                if isSSHPath(path) || logOffsets[path] > 0 {
+                        filter.FirstLine = 0
+                }
+                if isSSHPath(path) {
+                        logFile, err = openSSHLog(path, filter.Start, filter.End)
+                } else if logOffsets != nil {
+                        logFile, err = openStatefulLog(path)
+                } else {
+                        logFile, err = openLogInput(path)
+                }
+                if isSSHFailure(err) {
+                        return nil, fmt.Errorf("%s: %v", path, err)
+                }
+                if err != nil {
+                        logWarnf("Skipping unreadable log file %s: %v", path, err)
+                        continue
+                }
+                fileEntries, err := filter.scan(logFile, sourceName(path))
+                closeErr := logFile.Close()
+                if isSSHFailure(closeErr) {
+                        return nil, fmt.Errorf("%s: %v", path, closeErr)
+                }
+                if err == nil {
+                        err = closeErr
+                }
+                if err != nil {
+                        logWarnf("Stopped reading %s early: %v", path, err)
+                }
+                entries = append(entries, fileEntries...)
+                readable++
+        }
+        if readable == 0 {
+                return nil, fmt.Errorf("none of %s could be opened", strings.Join(cfg.LogPaths, ", "))
+        }
+        return entries, nil
+}
+
+// readJournal filters the journal entries in the window
+func readJournal(filter *lineFilter, startTime, endTime time.Time) ([]logEntry, error) {
+        source := journalSource(cfg.Units)
+        journal, err := openJournal(startTime, endTime, cfg.Units)
+        if err != nil {
+                return nil, fmt.Errorf("Failed to read the systemd journal: %v", err)
+        }
+        // journalctl's output has no lines to go back to
+        filter.FirstLine = 0
+        entries, err := filter.scan(journal, source)
+        if closeErr := journal.Close(); err == nil && closeErr != nil {
+                return nil, fmt.Errorf("Failed to read the systemd journal: %v", closeErr)
+        }
+        if err != nil {
+                logWarnf("Stopped reading %s early: %v", source, err)
+        }
+        return entries, nil
+}
+
+// entrySpan returns the earliest and latest timestamps among the entries,
+// or start and end if none of them has one
+func entrySpan(entries []logEntry, start, end time.Time) (time.Time, time.Time) {
+        var first, last time.Time
+        for _, entry := range entries {
+                if entry.Time.IsZero() {
+                        continue
+                }
+                if first.IsZero() || entry.Time.Before(first) {
+                        first = entry.Time
+                }
+                if entry.Time.After(last) {
+                        last = entry.Time
+                }
+        }
+        if first.IsZero() {
+                return start, end
+        }
+        return first, last
+}
+
+// emptyWindow is set when the last analysis found no log entries in its
+// window, so all doesn't ask for recommendations on an empty summary
+var emptyWindow bool
+
+// windowAnalysis is one window's entries on their way through the pipeline,
+// and what analyzing them found
+type windowAnalysis struct {
+        Start, End time.Time
+        Entries    []logEntry // After -preprocess
+        Stats      *runStats
+        Volume     logVolume
+        TopErrors  []topErrorRow // Counted before -dedup collapses the repeats
+
+        Outcome    chunkOutcome
+        Comparison *windowComparison
+}
+
+// prepareWindow runs -preprocess over the filtered entries and takes the
+// counts the summary reports on them; started is when reading the logs
+// began, for the summary's statistics
+func prepareWindow(entries []logEntry, filter *lineFilter, started time.Time) (*windowAnalysis, error) {
+        if cfg.Preprocess != "" && len(entries) > 0 {
+                processed, err := preprocessEntries(entries, cfg.Preprocess)
+                if err != nil {
+                        return nil, err
+                }
+                logInfof("-preprocess turned %d lines into %d", len(entries), len(processed))
+                entries = processed
+        }
+        return &windowAnalysis{
+                Start:     filter.Start,
+                End:       filter.End,
+                Entries:   entries,
+                Stats:     newRunStats(started, filter, len(entries)),
+                Volume:    bucketCounts(entries, filter.Start, filter.End, cfg.Bucket),
+                TopErrors: topErrorRows(entries, cfg.TopErrors),
+        }, nil
+}
+
+// analyze has the AI service analyze the entries, and the baseline when there
+// is one, and finishes the statistics. Nothing is written but the -metrics-file.
+func (w *windowAnalysis) analyze(filter *lineFilter, tokenizer Tokenizer, baseline *baselineWindow) {
+        if len(w.Entries) > 0 {
+                chunks := prepareChunks(w.Entries, tokenizer, w.Stats)
+                resetUsage()
+                proseReplies.Store(0)
+                w.Outcome = runChunks(chunks, tokenizer)
+                if baseline != nil && len(w.Outcome.Analyses) > 0 && !interrupted() {
+                        w.Comparison = compareWithBaseline(baseline, jsonWindow{Start: w.Start, End: w.End}, w.Outcome.Analyses, tokenizer)
+                }
+                w.Stats.Chunks, w.Stats.Successful, w.Stats.Errored = len(chunks), len(w.Outcome.Analyses), len(w.Outcome.Errors)
+                if cfg.Unredact {
+                        unredactOutcome(&w.Outcome, w.Comparison)
+                }
+                if filter.Skipped > 0 && filter.KeepUnparsed {
+                        logInfof("Analyzed %d lines with no recognizable timestamp undated", filter.Skipped)
+                } else if filter.Skipped > 0 {
+                        logWarnf("Skipped %d lines with no recognizable timestamp", filter.Skipped)
+                }
+                if filter.Unframed > 0 {
+                        logWarnf("Attached %d lines with no recognizable timestamp to the line before them, though they don't look like stack frames; check -ts-layout", filter.Unframed)
+                }
+        }
+        w.Stats.finish()
+        if cfg.MetricsFile != "" {
+                writeMetricsFile(cfg.MetricsFile, w.Stats, time.Now())
+        }
+}
+
+// analyzeEntries chunks the filtered entries, has the AI service analyze them
+// and writes the summary. It returns the exit code for the run; started is
+// when reading the logs began, for the summary's statistics. With a baseline
+// the summary also describes what changed relative to it.
+func analyzeEntries(entries []logEntry, filter *lineFilter, tokenizer Tokenizer, started time.Time, baseline *baselineWindow) int {
+        w, err := prepareWindow(entries, filter, started)
+        if err != nil {
+                logErrorf("Preprocessing failed: %v", err)
+                return exitFailed
+        }
+        startTime, endTime := w.Start, w.End
+        if cfg.CountOnly && !cfg.DryRun {
+                writeLineCounts(w.Entries, startTime, endTime, w.Stats)
+                return exitOK
+        }
+
+        // Nothing to analyze: say so instead of sending the model an empty chunk
+        emptyWindow = len(w.Entries) == 0
+        if emptyWindow {
+                logInfof("No log entries in window [%s, %s], skipping analysis",
+                        startTime.Format(time.RFC3339), endTime.Format(time.RFC3339))
+                if cfg.DryRun {
+                        reportChunks(nil, tokenizer)
+                        return exitOK
+                }
+                writeEmptySummary(startTime, endTime)
+                w.analyze(filter, tokenizer, nil)
+                return exitOK
+        }
+
+        if cfg.NoAI && !cfg.DryRun {
+                writeExtractiveSummary(w.Entries, w.Stats)
+                return exitOK
+        }
+        if cfg.DryRun {
+                reportChunks(prepareChunks(w.Entries, tokenizer, w.Stats), tokenizer)
+                return exitOK
+        }
+
+        w.analyze(filter, tokenizer, baseline)
+        outcome := w.Outcome
+        // With -ndjson and no -out the results only went to stdout
+        // If we have multiple successful analyses, create a simple concatenated summary
+        // Skip the "final summary" step that was causing problems
+        sinks := analysisSinks()
+        if len(outcome.Analyses) > 0 && len(sinks) > 0 {
+                summary := compileFinalSummary(outcome.Analyses, outcome.Errors, outcome.Truncated, outcome.Synthesis, outcome.ErrorExplanation, w.Comparison, startTime, endTime, w.Stats, w.Volume, w.TopErrors)
+                if summary != "" {
+                        writeSinks(sinks, Summary{Title: "log analysis", Text: summary})
+                }
+        } else if len(sinks) > 0 {
+                logWarnf("No successful analyses to summarize")
+        }
+        if cfg.OutputPath != "" {
+                if cfg.Format.wantsJSON() {
+                        writeJSONSummary(outcome.Results, outcome.Synthesis, w.Comparison, startTime, endTime, w.Stats, &w.Volume)
+                }
+
+                if cfg.Format == formatBoth {
+                        logInfof("Log analysis saved to %s and %s", cfg.OutputPath, jsonOutputPath())
+                } else {
+                        logInfof("Log analysis and recommendations saved to %s", cfg.OutputPath)
+                }
+        }
+        if cfg.Interactive && len(outcome.Analyses) > 0 && !interrupted() {
+                runInteractive(outcome.Analyses, tokenizer)
+        }
+        return outcome.exitCode()
+}
+
+// prepareChunks merges, deduplicates and renders the entries and splits them
+// into the chunks sent to the AI service, capped at -max-chunks and
+// -max-bytes. A -max-bytes cap is noted in stats unless it is nil.
+func prepareChunks(entries []logEntry, tokenizer Tokenizer, stats *runStats) []logChunk {
+        // Merge sources into a single chronological stream. -last-n keeps file
+        // order, as its timestamps may be missing or wrong.
+        if len(cfg.LogPaths) > 1 && cfg.LastN == 0 {
+                sort.SliceStable(entries, func(i, j int) bool {
+                        return entries[i].Time.Before(entries[j].Time)
+                })
+        }
+        if cfg.DropHealthchecks {
+                var suppressed int
+                entries, suppressed = collapseHealthchecks(entries)
+                logInfof("Suppressed %d health-check lines, leaving a count line for each run", suppressed)
+        }
+        if cfg.Dedup {
+                var collapsed int
+                entries, collapsed = dedupLines(entries, cfg.Normalize || cfg.DedupMode == "normalized")
+                logInfof("Deduplication collapsed %d repeated lines", collapsed)
+        }
+
+        filteredLogLines := make([]string, len(entries))
+        for i, entry := range entries {
+                // Tag lines with their source so the model can attribute issues to a host
+                filteredLogLines[i] = renderLine(entry, len(cfg.LogPaths) > 1)
+        }
+
+        var chunks []logChunk
+        if cfg.ChunkBy == "tokens" {
+                logInfof("Packing logs into chunks of up to %d estimated tokens", cfg.ChunkTokens)
+                chunks = buildTokenChunks(filteredLogLines, tokenizer)
+        } else {
+                // Determine chunk size based on number of lines
+                // Much smaller chunks to ensure we stay under context limit
+                linesPerChunk := cfg.ChunkLines
+
+                // If we have very few lines, process them all at once
+                if len(filteredLogLines) > 0 && len(filteredLogLines) <= linesPerChunk {
+                        linesPerChunk = len(filteredLogLines)
+                }
+
+                logInfof("Processing logs in chunks of %d lines", linesPerChunk)
+                chunks = buildChunks(filteredLogLines, linesPerChunk, tokenizer)
+        }
+        for i := range chunks {
+                chunkEntries := entries[chunks[i].First-1 : chunks[i].Last]
+                chunks[i].Start, chunks[i].End = entrySpan(chunkEntries, time.Time{}, time.Time{})
+                chunks[i].Lines = lineRanges(chunkEntries, len(cfg.LogPaths) > 1)
+        }
+        if cfg.MaxChunks > 0 && len(chunks) > cfg.MaxChunks {
+                total := len(chunks)
+                chunks = capChunks(chunks, cfg.MaxChunks, cfg.Overflow)
+                represented := 0
+                for _, chunk := range chunks {
+                        represented += chunk.Last - chunk.First + 1
+                }
+                logInfof("Capped %d chunks to %d (-overflow %s): %d of %d lines represented",
+                        total, len(chunks), cfg.Overflow, represented, len(filteredLogLines))
+        }
+        if cfg.MaxBytes > 0 && chunkBytes(chunks) > cfg.MaxBytes {
+                total := len(chunks)
+                chunks = capChunkBytes(chunks, cfg.MaxBytes, cfg.Overflow)
+                represented := 0
+                for _, chunk := range chunks {
+                        represented += chunk.Last - chunk.First + 1
+                }
+                if sent := chunkBytes(chunks); sent > cfg.MaxBytes {
+                        logWarnf("The first chunk alone is %d bytes, over -max-bytes %d; sending just that one", sent, cfg.MaxBytes)
+                }
+                logInfof("Capped input at %d bytes (-max-bytes, -overflow %s): %d of %d chunks, %d of %d lines represented",
+                        cfg.MaxBytes, cfg.Overflow, len(chunks), total, represented, len(filteredLogLines))
+                if stats != nil {
+                        stats.CapBytes, stats.CapLinesSent, stats.CapLinesTotal = cfg.MaxBytes, represented, len(filteredLogLines)
+                }
+        }
+        return chunks
+}
+
+// chunkOutcome is what the AI service made of a set of chunks
+type chunkOutcome struct {
+        Results   []chunkResult
+        Analyses  []string
+        Errors    []error
+        Truncated int
+
+        Synthesis        string
+        ErrorExplanation string
+}
+
+// exitCode reflects how many chunks failed, see exitCodesHelp
+func (o chunkOutcome) exitCode() int {
+        switch {
+        case interrupted():
+                return exitInterrupted
+        case len(o.Errors) == 0:
+                return exitOK
+        case len(o.Analyses) == 0:
+                return exitFailed
+        default:
+                return exitPartial
+        }
+}
+
+// runChunks sends the chunks to the AI service, then asks for the synthesis
+// and error explanation if those are enabled.
+func runChunks(chunks []logChunk, tokenizer Tokenizer) chunkOutcome {
+        var outcome chunkOutcome
+        outcome.Results = processChunks(chunks, tokenizer)
+        outcome.Analyses, outcome.Errors = collectResults(outcome.Results)
+        for _, r := range outcome.Results {
+                if r.Truncated {
+                        outcome.Truncated++
+                }
+        }
+        if outcome.Truncated > 0 {
+                logWarnf("%d chunk analyses were truncated by the model's output limit", outcome.Truncated)
+        }
+        if n := proseReplies.Load(); n > 0 {
+                logWarnf("-json-mode: %d replies were not findings JSON and were kept as prose", n)
+        }
+
+        // Optionally have the model write a real meta-summary of the chunk analyses
+        if cfg.Synthesize && len(outcome.Analyses) > 0 && !interrupted() {
+                summary, err := synthesizeSummary(outcome.Analyses, tokenizer)
+                if err != nil {
+                        logWarnf("Synthesis failed, falling back to concatenated analyses: %v", err)
+                } else {
+                        outcome.Synthesis = summary
+                }
+        }
+
+        if len(outcome.Errors) > 0 {
+                logWarnf("Chunk errors: %s", describeErrorCounts(outcome.Errors))
+        }
+        if cfg.ExplainErrors && len(outcome.Errors) > 0 && !interrupted() {
+                explanation, err := explainErrors(outcome.Errors)
+                if err != nil {
+                        logWarnf("Could not get an explanation of the errors: %v", err)
+                } else {
+                        outcome.ErrorExplanation = explanation
+                }
+        }
+
+        if u := currentUsage(); u.Requests > 0 {
+                logInfof("Token usage: %s", u)
+        }
+        if analysisCache != nil {
+                hits, misses := analysisCache.takeCounts()
+                logInfof("Analysis cache: %d hits, %d misses", hits, misses)
+        }
+        return outcome
+}
+
+// logChunk is a run of filtered log lines sent to the AI service in one request
+type logChunk struct {
+        Text  string
+        First int // 1-based line numbers within the filtered lines
+        Last  int
+
+        // Earliest and latest timestamps of the chunk's lines; zero when
+        // none of them has one
+        Start time.Time
+        End   time.Time
+
+        Lines string // Source lines the chunk covers, see lineRanges
+}
+
+// chunkLabel names a chunk in logs and the summary, with the source lines it
+// covers when they are known, e.g. "Part 3/12 (lines 91-120)"
+func chunkLabel(chunks []logChunk, idx int) string {
+        label := fmt.Sprintf("Part %d/%d", idx+1, len(chunks))
+        if chunks[idx].Lines != "" {
+                label += " (" + chunks[idx].Lines + ")"
+        }
+        return label
+}
+
+// lineRanges describes the source lines entries came from as "lines 91-120",
+// with the file name before each range when withSource is set or the entries
+// come from more than one file: "app.log lines 91-120, db.log lines 12-40".
+// Entries without line numbers are left out, so it is empty if none has one.
+// With -redact the file names are redacted, as the labels reach the model.
+func lineRanges(entries []logEntry, withSource bool) string {
+        type span struct{ first, last int }
+        spans := map[string]*span{}
+        var sources []string // In order of first appearance
+        for _, entry := range entries {
+                if entry.Line == 0 {
+                        continue
+                }
+                s, ok := spans[entry.Source]
+                if !ok {
+                        spans[entry.Source] = &span{entry.Line, entry.LastLine}
+                        sources = append(sources, entry.Source)
+                        continue
+                }
+                if entry.Line < s.first {
+                        s.first = entry.Line
+                }
+                if entry.LastLine > s.last {
+                        s.last = entry.LastLine
+                }
+        }
+
+        var parts []string
+        for _, source := range sources {
+                s := spans[source]
+                part := fmt.Sprintf("lines %d-%d", s.first, s.last)
+                if s.first == s.last {
+                        part = fmt.Sprintf("line %d", s.first)
+                }
+                if (withSource || len(sources) > 1) && source != "" {
+                        if redactions != nil {
+                                source = redactions.redact(source)
+                        }
+                        part = source + " " + part
+                }
+                parts = append(parts, part)
+        }
+        return strings.Join(parts, ", ")
+}
+
+// chunkResult is the outcome of processing one chunk
+type chunkResult struct {
+        Done      bool
+        Label     string
+        Analysis  string
+        Err       error // Why the chunk couldn't be analyzed; Analysis is empty then
+        Truncated bool  // The model stopped at its output limit
+}
+
+// capChunks keeps max of the chunks. "truncate" keeps the first ones, while
+// "sample" picks evenly spaced chunks so the whole window stays covered. Both
+// are deterministic, so reruns over the same input send the same chunks.
+func capChunks(chunks []logChunk, max int, overflow string) []logChunk {
+        if overflow == "truncate" {
+                return chunks[:max]
+        }
+        sampled := make([]logChunk, max)
+        for i := range sampled {
+                sampled[i] = chunks[i*len(chunks)/max]
+        }
+        return sampled
+}
+
+// chunkBytes is the size of the log text in chunks
+func chunkBytes(chunks []logChunk) int {
+        total := 0
+        for _, chunk := range chunks {
+                total += len(chunk.Text)
+        }
+        return total
+}
+
+// capChunkBytes keeps as many chunks as fit in max bytes of log text, chosen
+// like capChunks does. At least one chunk is always kept, so a cap smaller
+// than a single chunk still leaves something to analyze.
+func capChunkBytes(chunks []logChunk, max int, overflow string) []logChunk {
+        if overflow == "truncate" {
+                total := 0
+                for i, chunk := range chunks {
+                        total += len(chunk.Text)
+                        if total > max && i > 0 {
+                                return chunks[:i]
+                        }
+                }
+                return chunks
+        }
+        // Start from the count the average chunk size allows and sample fewer
+        // until the picked chunks fit
+        n := len(chunks) * max / chunkBytes(chunks)
+        for ; n > 1; n-- {
+                if sampled := capChunks(chunks, n, overflow); chunkBytes(sampled) <= max {
+                        return sampled
+                }
+        }
+        return capChunks(chunks, 1, overflow)
+}
+
+// Mark the -overlap lines so the model treats them as background only
+const (
+        overlapStart = "--- context from previous chunk ---"
+        overlapEnd   = "--- end of context ---"
+)
+
+// buildChunks splits the lines into chunks of up to linesPerChunk lines,
+// shrinking any chunk whose estimated size exceeds -chunk-tokens. With
+// -overlap each chunk also repeats the last lines of the one before it.
+func buildChunks(lines []string, linesPerChunk int, tok Tokenizer) []logChunk {
+        var chunks []logChunk
+        prevStart := 0
+        for i := 0; i < len(lines); {
+                end := i + linesPerChunk
+                if end > len(lines) {
+                        end = len(lines)
+                }
+
+                // The overlap only adds context; the chunk still covers lines[i:end],
+                // so i always advances however much the chunk is shrunk below
+                context := overlapContext(lines, prevStart, i)
+
+                chunkText := context + strings.Join(lines[i:end], "\n")
+
+                // Check if chunk is too large before processing
+                estimatedChunkTokens := tok.Estimate(chunkText)
+                if estimatedChunkTokens > cfg.ChunkTokens {
+                        // If too large, reduce chunk size; the remaining lines go to the next chunk
+                        reductionFactor := float64(cfg.ChunkTokens) / float64(estimatedChunkTokens)
+                        newEnd := i + int(float64(end-i)*reductionFactor)
+                        if newEnd <= i {
+                                newEnd = i + 1 // Ensure we process at least one line
+                        }
+
+                        logInfof("Chunk %d too large (%d tokens), reducing from %d to %d lines",
+                                len(chunks)+1, estimatedChunkTokens, end-i, newEnd-i)
+
+                        chunkText = context + strings.Join(lines[i:newEnd], "\n")
+                        end = newEnd
+                }
+
+                chunks = append(chunks, logChunk{Text: chunkText, First: i + 1, Last: end})
+                prevStart, i = i, end
+        }
+        return chunks
+}
+
+// buildTokenChunks is buildChunks for -chunk-by tokens: lines are packed
+// into chunks of up to -chunk-tokens by splitIntoChunks. Any -overlap context
+// comes on top of that budget.
+func buildTokenChunks(lines []string, tok Tokenizer) []logChunk {
+        var chunks []logChunk
+        prevStart, i := 0, 0
+        for _, group := range splitIntoChunks(lines, cfg.ChunkTokens, tok) {
+                end := i + len(group)
+                chunkText := overlapContext(lines, prevStart, i) + strings.Join(group, "\n")
+                chunks = append(chunks, logChunk{Text: chunkText, First: i + 1, Last: end})
+                prevStart, i = i, end
+        }
+        return chunks
+}
+
+// splitIntoChunks greedily packs lines into chunks, starting a new chunk when
+// adding the next line would push the chunk's estimate past limit. A line
+// over the limit on its own still gets a chunk to itself rather than being
+// dropped.
+func splitIntoChunks(lines []string, limit int, tok Tokenizer) [][]string {
+        var chunks [][]string
+        var current []string
+        text := ""
+        for _, line := range lines {
+                candidate := line
+                if len(current) > 0 {
+                        candidate = text + "\n" + line
+                }
+                if len(current) > 0 && tok.Estimate(candidate) > limit {
+                        chunks = append(chunks, current)
+                        current, candidate = nil, line
+                }
+                current = append(current, line)
+                text = candidate
+        }
+        if len(current) > 0 {
+                chunks = append(chunks, current)
+        }
+        return chunks
+}
+
+// overlapContext returns the -overlap lines before lines[i], wrapped in
+// markers, without reaching back past the previous chunk's start
+func overlapContext(lines []string, prevStart, i int) string {
+        if cfg.Overlap <= 0 || i == 0 {
+                return ""
+        }
+        from := i - cfg.Overlap
+        if from < prevStart {
+                from = prevStart
+        }
+        return overlapStart + "\n" + strings.Join(lines[from:i], "\n") + "\n" + overlapEnd + "\n"
+}
+
+// processChunks sends the chunks to the AI service using up to cfg.Concurrency
+// workers, -batch chunks per request. Results are kept in chunk order
+// regardless of completion order.
+func processChunks(chunks []logChunk, tok Tokenizer) []chunkResult {
+        results := make([]chunkResult, len(chunks))
+        var mu sync.Mutex // Guards results, lastSave and the checkpoint
+        var lastSave time.Time
+
+        // With -resume, chunks finished by an earlier run are taken from the checkpoint
+        var cp *checkpoint
+        pending := len(chunks)
+        if cfg.Resume {
+                cp = loadCheckpoint(chunks)
+                for idx, chunk := range cp.Chunks {
+                        results[idx] = chunkResult{Done: true, Label: chunk.Label, Analysis: chunk.Analysis, Truncated: chunk.Truncated}
+                }
+                if len(cp.Chunks) > 0 {
+                        logInfof("Resuming from %s: %d of %d chunks already analyzed", checkpointPath(), len(cp.Chunks), len(chunks))
+                }
+                pending -= len(cp.Chunks)
+        }
+
+        progress := newProgressTracker(pending, cfg.Concurrency)
+        progress.Start()
+
+        jobs := make(chan []int)
+        var wg sync.WaitGroup
+        for w := 0; w < cfg.Concurrency; w++ {
+                wg.Add(1)
+                go func() {
+                        defer wg.Done()
+                        for group := range jobs {
+                                chunkStart := time.Now()
+                                var done []chunkResult
+                                if len(group) == 1 {
+                                        idx := group[0]
+                                        chunk := chunks[idx]
+                                        if chunk.Lines != "" {
+                                                logInfof("Processing chunk %d/%d (%s)", idx+1, len(chunks), chunk.Lines)
+                                        } else {
+                                                logInfof("Processing chunk %d/%d (lines %d-%d)",
+                                                        idx+1, len(chunks), chunk.First, chunk.Last)
+                                        }
+
+                                        label := chunkLabel(chunks, idx)
+                                        analysis, truncated, err := processLogChunk(chunk, label, idx+1)
+                                        done = []chunkResult{{Done: true, Label: label, Analysis: analysis, Err: err, Truncated: truncated}}
+                                } else {
+                                        done = processChunkBatch(chunks, group)
+                                }
+                                took := time.Since(chunkStart) / time.Duration(len(group))
+
+                                for i, idx := range group {
+                                        r := done[i]
+                                        progress.ChunkDone(took)
+                                        if r.Err != nil {
+                                                logErrorf("Error processing chunk %d/%d: %v",
+                                                        idx+1, len(chunks), r.Err)
+                                        } else {
+                                                logInfof("Successfully processed chunk %d/%d",
+                                                        idx+1, len(chunks))
+                                        }
+                                        progress.Report()
+
+                                        mu.Lock()
+                                        results[idx] = r
+                                        if cfg.NDJSON {
+                                                writeNDJSONRecord(idx+1, r)
+                                        }
+                                        if cp != nil && r.Err == nil {
+                                                cp.Chunks[idx] = checkpointChunk{Label: r.Label, Analysis: r.Analysis, Truncated: r.Truncated}
+                                                cp.save()
+                                        }
+                                        // Save progress, but not more often than progressSaveInterval
+                                        if saveProgressEnabled() && time.Since(lastSave) >= progressSaveInterval {
+                                                saveProgress(collectResults(results))
+                                                lastSave = time.Now()
+                                        }
+                                        mu.Unlock()
+                                }
+                        }
+                }()
+        }
+
+dispatch:
+        for idx := 0; idx < len(chunks); {
+                if results[idx].Done {
+                        idx++
+                        continue
+                }
+                group := nextBatch(chunks, results, idx, tok)
+                select {
+                case jobs <- group:
+                case <-stopDispatch:
+                        logWarnf("Stopped dispatching after %d of %d chunks", idx, len(chunks))
+                        break dispatch
+                }
+                idx = group[len(group)-1] + 1
+        }
+        close(jobs)
+        wg.Wait()
+
+        if cp != nil && len(cp.Chunks) == len(chunks) {
+                cp.remove()
+        }
+
+        // Make sure the last completed chunks are on disk even if the final save was debounced
+        if saveProgressEnabled() {
+                saveProgress(collectResults(results))
+        }
+        return results
+}
+
+// reportChunks prints the size of each chunk instead of sending it (-dry-run)
+func reportChunks(chunks []logChunk, tok Tokenizer) {
+        totalTokens := 0
+        for idx, chunk := range chunks {
+                tokens := tok.Estimate(chunk.Text)
+                totalTokens += tokens
+                fmt.Printf("%s: %d lines, %d chars, ~%d tokens\n",
+                        chunkLabel(chunks, idx), chunk.Last-chunk.First+1, len(chunk.Text), tokens)
+        }
+        fmt.Printf("Total: %d chunks, ~%d estimated tokens\n", len(chunks), totalTokens)
+}
+
+// collectResults flattens the completed results, in chunk order, into
+// successful analyses and errors.
+func collectResults(results []chunkResult) ([]string, []error) {
+        var analyses []string
+        var errors []error
+        for _, r := range results {
+                if !r.Done {
+                        continue
+                }
+                if r.Err != nil {
+                        errors = append(errors, r.Err)
+                } else {
+                        analyses = append(analyses, r.Analysis)
+                }
+        }
+        return analyses, errors
+}
+
+// Default system prompt for chunk analysis, replaced by -system-prompt
+const defaultSystemPrompt = "You are a log analyzer. Extract the MOST IMPORTANT issues and patterns from the logs. Be concise. Focus only on critical findings."
+
+// Marks an analysis the model cut off at its output limit
+const truncatedBanner = "[TRUNCATED] The model hit its output limit; this analysis is incomplete.\n\n"
+
+// processLogChunk analyzes one chunk. It returns the analysis and whether the
+// model cut it off, or the error from requestAnalysis.
+func processLogChunk(chunk logChunk, chunkLabel string, chunkNum int) (string, bool, error) {
+        logText := chunk.Text
+        timeRange := chunkTimeRange(chunk)
+        var key string
+        if analysisCache != nil {
+                key = cacheKey(cfg.Model, cfg.SystemPrompt, logText)
+                if entry, ok := analysisCache.get(key); ok {
+                        logInfof("Using cached analysis for %s", chunkLabel)
+                        return analysisHeader(chunkLabel) + entry.Analysis, false, nil
+                }
+        }
+
+        analysis, finishReason, err := requestAnalysis(cfg.SystemPrompt, chunkPrompt(logText, timeRange), chunkLabel, chunkNum)
+        if err != nil {
+                return "", false, err
+        }
+        if cfg.JSONMode && finishReason != "length" {
+                analysis = jsonFindings(analysis, chunkLabel)
+        }
+
+        truncated := finishReason == "length"
+        if truncated && cfg.RetryTruncated {
+                logWarnf("Response for %s was truncated, retrying in two halves", chunkLabel)
+                if retried, stillTruncated, ok := retryTruncatedChunk(logText, timeRange, chunkLabel); ok {
+                        analysis, truncated = retried, stillTruncated
+                }
+        }
+        if truncated {
+                logWarnf("Response for %s was truncated by the model's output limit", chunkLabel)
+                analysis = truncatedBanner + analysis
+        }
+        if analysisCache != nil && !truncated {
+                analysisCache.put(key, cacheEntry{Model: cfg.Model, Analysis: analysis})
+        }
+        return analysisHeader(chunkLabel) + analysis, truncated, nil
+}
+
+// Tells the model the span of the chunk it is given, see chunkTimeRange
+const timeRangeTemplate = "These logs span {start}–{end}."
+
+// chunkTimeRange fills in timeRangeTemplate for a chunk, showing dates only
+// when the chunk crosses midnight. It is empty when the chunk's lines have no
+// timestamps.
+func chunkTimeRange(chunk logChunk) string {
+        if chunk.Start.IsZero() {
+                return ""
+        }
+        layout := "15:04:05"
+        if chunk.Start.Format("2006-01-02") != chunk.End.Format("2006-01-02") {
+                layout = "2006-01-02 15:04:05"
+        }
+        return strings.NewReplacer(
+                "{start}", chunk.Start.Format(layout),
+                "{end}", chunk.End.Format(layout+" MST"),
+        ).Replace(timeRangeTemplate)
+}
+
+// analysisInstructions are what chunkPrompt and the -batch prompt both ask
+// of the analyses: the finding format, and what the -context-lines marker means
+func analysisInstructions() string {
+        var parts []string
+        if !cfg.JSONMode {
+                // -json-mode asks for JSON in the system prompt instead
+                parts = append(parts, findingFormatPrompt)
+        }
+        if cfg.ContextLines > 0 {
+                parts = append(parts, "Lines marked "+strings.TrimSpace(contextMarker)+" are lower-severity lines shown only for what led up to or followed the line next to them.")
+        }
+        return strings.Join(parts, " ")
+}
+
+// chunkPrompt is the user message for a chunk, opened by its time range
+// sentence if it has one and closed by the -prompt-suffix
+func chunkPrompt(logText, timeRange string) string {
+        prompt := "Analyze these logs and identify the most important issues. Keep your response SHORT and FOCUSED only on critical findings."
+        if instructions := analysisInstructions(); instructions != "" {
+                prompt += " " + instructions
+        }
+        if timeRange != "" {
+                prompt = timeRange + " " + prompt
+        }
+        prompt += "\n\n" + logText
+        if cfg.PromptSuffix != "" {
+                prompt += "\n\n" + cfg.PromptSuffix
+        }
+        return prompt
+}
+
+// retryTruncatedChunk re-analyzes a chunk as two smaller halves so each reply
+// has more room. ok is false if the chunk can't be split or a half failed, in
+// which case the original truncated analysis should be kept.
+func retryTruncatedChunk(logText, timeRange, chunkLabel string) (string, bool, bool) {
+        lines := strings.Split(logText, "\n")
+        if len(lines) < 2 {
+                return "", false, false
+        }
+        mid := len(lines) / 2
+        halves := []string{strings.Join(lines[:mid], "\n"), strings.Join(lines[mid:], "\n")}
+
+        var parts []string
+        truncated := false
+        for i, half := range halves {
+                label := fmt.Sprintf("%s (half %d/2)", chunkLabel, i+1)
+                analysis, finishReason, err := requestAnalysis(cfg.SystemPrompt, chunkPrompt(half, timeRange), label, 0)
+                if err != nil {
+                        logWarnf("Retry of %s failed: %v", label, err)
+                        return "", false, false
+                }
+                if finishReason == "length" {
+                        truncated = true
+                } else if cfg.JSONMode {
+                        analysis = jsonFindings(analysis, label)
+                }
+                parts = append(parts, analysis)
+        }
+        return strings.Join(parts, "\n\n"), truncated, true
+}
+
+// synthesizeSummary asks the model for a single meta-summary of the chunk
+// analyses. When they don't fit in one request they are summarized in
+// batches, and the batch summaries reduced again, until one request suffices.
+// A batch whose request fails keeps its raw analysis text instead.
+func synthesizeSummary(analyses []string, tok Tokenizer) (string, error) {
+        const systemPrompt = "You are a log analyzer. You are given analyses of consecutive segments of the same logs. " +
+                "Merge them into one concise summary of the MOST IMPORTANT issues and patterns. Remove duplicates. Focus only on critical findings."
+        const userPrompt = "Combine these log analyses into a single short summary of the most important issues:\n\n%s"
+
+        current := analyses
+        for level := 1; level <= maxSynthesisLevels; level++ {
+                batches := batchByTokens(current, cfg.ChunkTokens, tok)
+                if len(batches) == 1 {
+                        logInfof("Synthesizing final summary from %d analyses", len(current))
+                        summary, _, err := requestAnalysis(systemPrompt, fmt.Sprintf(userPrompt, batches[0]), "Synthesis", 0)
+                        return summary, err
+                }
+
+                logInfof("Synthesis level %d: reducing %d analyses in %d batches", level, len(current), len(batches))
+                var reduced []string
+                for i, batch := range batches {
+                        label := fmt.Sprintf("Synthesis level %d batch %d/%d", level, i+1, len(batches))
+                        summary, _, err := requestAnalysis(systemPrompt, fmt.Sprintf(userPrompt, batch), label, 0)
+                        if err != nil {
+                                logWarnf("%s failed, keeping its raw analyses: %v", label, err)
+                                summary = batch
+                        }
+                        reduced = append(reduced, summary)
+                }
+
+                // Give up rather than loop forever if nothing got shorter
+                if len(reduced) >= len(current) {
+                        break
+                }
+                current = reduced
+        }
+        return "", errors.New("could not reduce the chunk analyses to a single summary")
+}
+
+// batchByTokens joins consecutive texts into batches whose estimated size
+// stays within limit. A text that exceeds the limit alone gets its own batch.
+func batchByTokens(texts []string, limit int, tok Tokenizer) []string {
+        var batches []string
+        var current strings.Builder
+        currentTokens := 0
+        for _, text := range texts {
+                tokens := tok.Estimate(text)
+                if current.Len() > 0 && currentTokens+tokens > limit {
+                        batches = append(batches, current.String())
+                        current.Reset()
+                        currentTokens = 0
+                }
+                if current.Len() > 0 {
+                        current.WriteString("\n\n---\n\n")
+                }
+                current.WriteString(text)
+                currentTokens += tokens
+        }
+        if current.Len() > 0 {
+                batches = append(batches, current.String())
+        }
+        return batches
+}
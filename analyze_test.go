@@ -0,0 +1,77 @@
+package main
+
+import (
+        "reflect"
+        "testing"
+)
+
+// lenTokenizer counts one token per byte, so limits in tests are exact
+type lenTokenizer struct{}
+
+func (lenTokenizer) Estimate(text string) int { return len(text) }
+
+func TestSplitIntoChunks(t *testing.T) {
+        tests := []struct {
+                name  string
+                lines []string
+                limit int
+                want  [][]string
+        }{
+                {
+                        name:  "empty input",
+                        lines: nil,
+                        limit: 10,
+                        want:  nil,
+                },
+                {
+                        name:  "everything fits",
+                        lines: []string{"aa", "bb", "cc"},
+                        limit: 100,
+                        want:  [][]string{{"aa", "bb", "cc"}},
+                },
+                {
+                        // "aaaa\nbbbb" is exactly 9 bytes
+                        name:  "chunk exactly at the limit",
+                        lines: []string{"aaaa", "bbbb", "cccc"},
+                        limit: 9,
+                        want:  [][]string{{"aaaa", "bbbb"}, {"cccc"}},
+                },
+                {
+                        name:  "one byte over the limit starts a new chunk",
+                        lines: []string{"aaaa", "bbbb", "cccc"},
+                        limit: 8,
+                        want:  [][]string{{"aaaa"}, {"bbbb"}, {"cccc"}},
+                },
+                {
+                        name:  "single line exactly at the limit",
+                        lines: []string{"aaaaaaaaaa"},
+                        limit: 10,
+                        want:  [][]string{{"aaaaaaaaaa"}},
+                },
+                {
+                        name:  "single over-limit line gets a chunk to itself",
+                        lines: []string{"aa", "this line is far too long", "bb"},
+                        limit: 5,
+                        want:  [][]string{{"aa"}, {"this line is far too long"}, {"bb"}},
+                },
+                {
+                        name:  "only an over-limit line",
+                        lines: []string{"this line is far too long"},
+                        limit: 5,
+                        want:  [][]string{{"this line is far too long"}},
+                },
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        got := splitIntoChunks(tt.lines, tt.limit, lenTokenizer{})
+                        if !reflect.DeepEqual(got, tt.want) {
+                                t.Errorf("splitIntoChunks = %q, want %q", got, tt.want)
+                        }
+                        for _, chunk := range got {
+                                if len(chunk) == 0 {
+                                        t.Errorf("empty chunk in %q", got)
+                                }
+                        }
+                })
+        }
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+        "fmt"
+        "regexp"
+        "strings"
+)
+
+// batchPrompt opens a -batch request; the chunks follow as separate messages
+const batchPrompt = "You will receive %d log segments, each in its own message starting with its label, e.g. \"=== Part 1/9 (lines 1-40) ===\". " +
+        "Analyze each segment separately and identify its most important issues. Keep each analysis SHORT and FOCUSED only on critical findings. %s " +
+        "Answer with one section per segment, in order, each starting with the segment's label line exactly as given."
+
+// batchSectionPattern matches the label lines that separate the sections of
+// a batched reply, as written by analysisHeader
+var batchSectionPattern = regexp.MustCompile(`(?m)^\s*=== (.+?) ===\s*$`)
+
+// batchPartPattern finds the "Part n/m" a label starts with
+var batchPartPattern = regexp.MustCompile(`^Part \d+/\d+\b`)
+
+// batchPart keys the sections of a batched reply by the "Part n/m" of their
+// label, since models often drop or reword the line ranges after it. Other
+// labels are used whole.
+func batchPart(label string) string {
+        if part := batchPartPattern.FindString(label); part != "" {
+                return part
+        }
+        return label
+}
+
+// batchCacheKey keeps the cached analyses of batched chunks apart from those
+// of chunks sent on their own, whose prompt is different
+func batchCacheKey(logText string) string {
+        return cacheKey(cfg.Model, cfg.SystemPrompt+"\x00batch", logText)
+}
+
+// nextBatch returns the pending chunks starting at chunks[first] to send in
+// one request: up to -batch consecutive chunks whose combined estimate stays
+// within -chunk-tokens. The first chunk is always included.
+func nextBatch(chunks []logChunk, results []chunkResult, first int, tok Tokenizer) []int {
+        group := []int{first}
+        tokens := tok.Estimate(chunks[first].Text)
+        for idx := first + 1; idx < len(chunks) && len(group) < cfg.Batch && !results[idx].Done; idx++ {
+                t := tok.Estimate(chunks[idx].Text)
+                if tokens+t > cfg.ChunkTokens {
+                        break
+                }
+                group = append(group, idx)
+                tokens += t
+        }
+        return group
+}
+
+// processChunkBatch analyzes several chunks in one request and splits the
+// reply back into one result per chunk. Cached chunks are answered from the
+// cache, and any chunk the reply has no section for is sent again on its own.
+func processChunkBatch(chunks []logChunk, group []int) []chunkResult {
+        results := make([]chunkResult, len(group))
+        labels := make([]string, len(group))
+        var prompts []string
+        var sent []int // Positions in group of the chunks in the request
+        for i, idx := range group {
+                labels[i] = chunkLabel(chunks, idx)
+                if analysisCache != nil {
+                        if entry, ok := analysisCache.get(batchCacheKey(chunks[idx].Text)); ok {
+                                logInfof("Using cached analysis for %s", labels[i])
+                                results[i] = chunkResult{Done: true, Label: labels[i], Analysis: analysisHeader(labels[i]) + entry.Analysis}
+                                continue
+                        }
+                }
+                prompt := strings.TrimRight(analysisHeader(labels[i]), "\n") + "\n"
+                if timeRange := chunkTimeRange(chunks[idx]); timeRange != "" {
+                        prompt += timeRange + "\n"
+                }
+                prompts = append(prompts, prompt+chunks[idx].Text)
+                sent = append(sent, i)
+        }
+        if len(sent) == 0 {
+                return results
+        }
+
+        first, last := group[sent[0]], group[sent[len(sent)-1]]
+        logInfof("Processing chunks %d-%d/%d in one request (%d chunks)", first+1, last+1, len(chunks), len(sent))
+        instructions := fmt.Sprintf(batchPrompt, len(sent), analysisInstructions())
+        if cfg.PromptSuffix != "" {
+                instructions += "\n\n" + cfg.PromptSuffix
+        }
+        prompts = append([]string{instructions}, prompts...)
+        batchLabel := fmt.Sprintf("Parts %d-%d/%d", first+1, last+1, len(chunks))
+        reply, finishReason, err := requestTurns(cfg.SystemPrompt, prompts, batchLabel, first+1)
+        if err != nil {
+                for _, i := range sent {
+                        results[i] = chunkResult{Done: true, Label: labels[i], Err: err}
+                }
+                return results
+        }
+
+        sections := splitBatchReply(reply)
+        lastFound := -1
+        for _, i := range sent {
+                if _, ok := sections[batchPart(labels[i])]; ok {
+                        lastFound = i
+                }
+        }
+        for _, i := range sent {
+                analysis, ok := sections[batchPart(labels[i])]
+                if !ok {
+                        logWarnf("The batched reply has no section for %s, sending it on its own", labels[i])
+                        chunkAnalysis, truncated, err := processLogChunk(chunks[group[i]], labels[i], group[i]+1)
+                        results[i] = chunkResult{Done: true, Label: labels[i], Analysis: chunkAnalysis, Err: err, Truncated: truncated}
+                        continue
+                }
+                // Only the last section can have been cut off by the output limit
+                truncated := finishReason == "length" && i == lastFound
+                if truncated {
+                        logWarnf("Response for %s was truncated by the model's output limit", labels[i])
+                        analysis = truncatedBanner + analysis
+                }
+                if analysisCache != nil && !truncated {
+                        analysisCache.put(batchCacheKey(chunks[group[i]].Text), cacheEntry{Model: cfg.Model, Analysis: analysis})
+                }
+                results[i] = chunkResult{Done: true, Label: labels[i], Analysis: analysisHeader(labels[i]) + analysis, Truncated: truncated}
+        }
+        return results
+}
+
+// splitBatchReply maps the "Part n/m" of each section of a batched reply to
+// its text
+func splitBatchReply(reply string) map[string]string {
+        sections := map[string]string{}
+        matches := batchSectionPattern.FindAllStringSubmatchIndex(reply, -1)
+        for n, m := range matches {
+                end := len(reply)
+                if n+1 < len(matches) {
+                        end = matches[n+1][0]
+                }
+                text := strings.TrimSpace(reply[m[1]:end])
+                if text != "" {
+                        sections[batchPart(reply[m[2]:m[3]])] = text
+                }
+        }
+        return sections
+}
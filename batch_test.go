@@ -0,0 +1,50 @@
+package main
+
+import (
+        "fmt"
+        "reflect"
+        "strings"
+        "testing"
+)
+
+func TestSplitBatchReply(t *testing.T) {
+        reply := "Here are the analyses.\n\n" +
+                "=== Part 1/3 (lines 1-40) ===\n" +
+                "[HIGH] disk full\n\n" +
+                "=== Part 2/3 ===\n" +
+                "Nothing critical.\n\n" +
+                "=== Part 3/3 (app.log lines 81-120, db.log line 7) ===\n" +
+                "[MEDIUM] slow queries\n"
+        want := map[string]string{
+                "Part 1/3": "[HIGH] disk full",
+                "Part 2/3": "Nothing critical.",
+                "Part 3/3": "[MEDIUM] slow queries",
+        }
+        if got := splitBatchReply(reply); !reflect.DeepEqual(got, want) {
+                t.Errorf("splitBatchReply = %q, want %q", got, want)
+        }
+
+        // The chunk labels find their sections whether or not the reply kept
+        // the line ranges
+        for _, label := range []string{"Part 1/3 (lines 1-40)", "Part 2/3 (lines 41-80)", "Part 3/3"} {
+                if _, ok := want[batchPart(label)]; !ok {
+                        t.Errorf("no section for %q", label)
+                }
+        }
+}
+
+func TestBatchPromptSharesChunkInstructions(t *testing.T) {
+        saved := cfg
+        t.Cleanup(func() { cfg = saved })
+        cfg.ContextLines, cfg.JSONMode = 2, false
+
+        instructions := fmt.Sprintf(batchPrompt, 2, analysisInstructions())
+        for _, want := range []string{findingFormatPrompt, strings.TrimSpace(contextMarker)} {
+                if !strings.Contains(instructions, want) {
+                        t.Errorf("batch instructions lack %q:\n%s", want, instructions)
+                }
+        }
+        if batchCacheKey("logs") == cacheKey(cfg.Model, cfg.SystemPrompt, "logs") {
+                t.Error("batched and single-chunk analyses share a cache key")
+        }
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+        "errors"
+        "sync"
+        "time"
+)
+
+// breaker stops requests to an endpoint that keeps failing, for
+// -breaker-threshold; nil disables it
+var breaker *circuitBreaker
+
+// serveBreakerCooldown is how long -serve fails requests straight away once
+// the circuit opened before trying the AI service again
+const serveBreakerCooldown = time.Minute
+
+// errEndpointDown fails a request without sending it while the circuit is open
+var errEndpointDown = errors.New("skipped (endpoint down)")
+
+// circuitBreaker opens after threshold requests in a row failed to reach the
+// endpoint, each after its retries, and then fails every request straight
+// away. With a cooldown it half-opens once that has passed, letting one trial
+// request through: success closes the circuit again, failure keeps it open
+// for another cooldown. Without one it stays open for the rest of the run.
+type circuitBreaker struct {
+        mu        sync.Mutex
+        threshold int
+        cooldown  time.Duration
+        failures  int // Consecutive requests that failed to reach the endpoint
+        open      bool
+        openedAt  time.Time
+        probing   bool // The half-open trial request is in flight
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+        return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow returns errEndpointDown if a request must not be sent now
+func (b *circuitBreaker) allow() error {
+        b.mu.Lock()
+        defer b.mu.Unlock()
+        if !b.open {
+                return nil
+        }
+        if b.cooldown <= 0 || b.probing || time.Since(b.openedAt) < b.cooldown {
+                return errEndpointDown
+        }
+        logInfof("Circuit breaker half-open: trying one request to the AI service")
+        b.probing = true
+        return nil
+}
+
+// abandon notes that a request allow let through was cancelled, so a
+// half-open circuit can try again with the next one
+func (b *circuitBreaker) abandon() {
+        b.mu.Lock()
+        defer b.mu.Unlock()
+        b.probing = false
+}
+
+// record notes the outcome of a request allow let through. failed is set for
+// transport failures only; an HTTP error still means the server is up.
+func (b *circuitBreaker) record(failed bool) {
+        b.mu.Lock()
+        defer b.mu.Unlock()
+        wasProbe := b.probing
+        b.probing = false
+        if !failed {
+                if b.open {
+                        logInfof("Circuit breaker closed: the AI service is answering again")
+                }
+                b.failures, b.open = 0, false
+                return
+        }
+        b.failures++
+        switch {
+        case wasProbe:
+                b.openedAt = time.Now()
+                logWarnf("Circuit breaker: the trial request failed, staying open for %s", b.cooldown)
+        case !b.open && b.failures >= b.threshold:
+                b.open, b.openedAt = true, time.Now()
+                if b.cooldown > 0 {
+                        logErrorf("Circuit breaker open: %d requests in a row failed to reach the AI service; skipping requests for %s", b.failures, b.cooldown)
+                } else {
+                        logErrorf("Circuit breaker open: %d requests in a row failed to reach the AI service; skipping the remaining chunks", b.failures)
+                }
+        }
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "encoding/json"
+        "fmt"
+        "os"
+        "path/filepath"
+        "sync"
+        "time"
+)
+
+// chunkCache stores successful chunk analyses on disk, keyed by a hash of the
+// model, system prompt, reply settings and chunk text, so re-runs over
+// overlapping windows don't pay for the same chunk twice. Truncated analyses
+// aren't stored, so raising -max-tokens gets a complete one. A nil
+// *chunkCache is a disabled cache.
+type chunkCache struct {
+        dir string
+        ttl time.Duration // 0 never expires
+
+        mu     sync.Mutex
+        hits   int
+        misses int
+}
+
+type cacheEntry struct {
+        Model    string    `json:"model"`
+        Created  time.Time `json:"created"`
+        Analysis string    `json:"analysis"`
+}
+
+// analysisCache is set up from -cache-dir by checkAnalyzeFlags
+var analysisCache *chunkCache
+
+func newChunkCache(dir string, ttl time.Duration) (*chunkCache, error) {
+        if err := os.MkdirAll(dir, 0755); err != nil {
+                return nil, err
+        }
+        return &chunkCache{dir: dir, ttl: ttl}, nil
+}
+
+func cacheKey(model, systemPrompt, logText string) string {
+        h := sha256.New()
+        // The same settings as checkpointKey, which change the reply too
+        replySettings := fmt.Sprintf("%s\x00%g\x00%g\x00%d", cfg.APIStyle, cfg.Temperature, cfg.TopP, cfg.MaxResponseTokens)
+        parts := []string{model, systemPrompt, replySettings, logText}
+        if cfg.PromptSuffix != "" {
+                // Only when set, so existing cache entries stay valid without one
+                parts = append(parts, cfg.PromptSuffix)
+        }
+        if contextDoc != "" {
+                parts = append(parts, contextDoc)
+        }
+        for _, part := range parts {
+                h.Write([]byte(part))
+                h.Write([]byte{0})
+        }
+        return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *chunkCache) path(key string) string {
+        return filepath.Join(c.dir, key+".json")
+}
+
+// get returns the cached analysis for key. Unreadable or expired entries are
+// misses; they get overwritten by the next put.
+func (c *chunkCache) get(key string) (cacheEntry, bool) {
+        var entry cacheEntry
+        data, err := os.ReadFile(c.path(key))
+        ok := err == nil && json.Unmarshal(data, &entry) == nil &&
+                (c.ttl <= 0 || time.Since(entry.Created) < c.ttl)
+
+        c.mu.Lock()
+        defer c.mu.Unlock()
+        if ok {
+                c.hits++
+        } else {
+                c.misses++
+        }
+        return entry, ok
+}
+
+func (c *chunkCache) put(key string, entry cacheEntry) {
+        entry.Created = time.Now()
+        data, err := json.Marshal(entry)
+        if err == nil {
+                err = writeFileAtomic(c.path(key), data, 0644)
+        }
+        if err != nil {
+                logWarnf("Failed to write cache entry %s: %v", key, err)
+        }
+}
+
+// takeCounts returns the hits and misses since the last call
+func (c *chunkCache) takeCounts() (int, int) {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+        hits, misses := c.hits, c.misses
+        c.hits, c.misses = 0, 0
+        return hits, misses
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+        "net/http"
+        "testing"
+)
+
+func TestCacheKeyCoversReplySettings(t *testing.T) {
+        saved := cfg
+        t.Cleanup(func() { cfg = saved })
+        base := cacheKey("model", "system", "logs")
+        changes := map[string]func(){
+                "max-tokens":  func() { cfg.MaxResponseTokens += 100 },
+                "temperature": func() { cfg.Temperature += 0.5 },
+                "top-p":       func() { cfg.TopP += 0.1 },
+                "api-style":   func() { cfg.APIStyle = "other" },
+        }
+        for name, change := range changes {
+                cfg = saved
+                change()
+                if cacheKey("model", "system", "logs") == base {
+                        t.Errorf("changing -%s keeps the cache key", name)
+                }
+        }
+}
+
+func TestTruncatedAnalysesAreNotCached(t *testing.T) {
+        requests := stubAIService(t, http.StatusOK, "application/json",
+                `{"choices":[{"message":{"content":"partial"},"finish_reason":"length"}]}`)
+        cfg.RetryTruncated = false
+        saved := analysisCache
+        t.Cleanup(func() { analysisCache = saved })
+        cache, err := newChunkCache(t.TempDir(), 0)
+        if err != nil {
+                t.Fatal(err)
+        }
+        analysisCache = cache
+
+        chunk := logChunk{Text: "2024-01-02T15:00:00Z ERROR boom"}
+        for i := 0; i < 2; i++ {
+                if _, truncated, err := processLogChunk(chunk, "Part 1/1", 1); err != nil || !truncated {
+                        t.Fatalf("processLogChunk = truncated %v, error %v; want a truncated analysis", truncated, err)
+                }
+        }
+        if n := requests.Load(); n != 2 {
+                t.Errorf("%d requests, want 2: the truncated analysis was served from the cache", n)
+        }
+}
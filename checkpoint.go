@@ -0,0 +1,92 @@
+package main
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "encoding/json"
+        "fmt"
+        "os"
+)
+
+// checkpoint records the chunks of a -resume run that have been analyzed, so
+// a rerun after a crash only sends the rest. Key covers the chunk texts and
+// every setting that shapes a reply, so a checkpoint is never reused for a
+// different input, model or prompt.
+type checkpoint struct {
+        Key    string                  `json:"key"`
+        Chunks map[int]checkpointChunk `json:"chunks"` // By chunk index
+}
+
+type checkpointChunk struct {
+        Label     string `json:"label"`
+        Analysis  string `json:"analysis"`
+        Truncated bool   `json:"truncated,omitempty"`
+}
+
+// checkpointPath is where -resume keeps its checkpoint, next to the summary
+func checkpointPath() string {
+        return cfg.OutputPath + ".checkpoint"
+}
+
+func checkpointKey(chunks []logChunk) string {
+        h := sha256.New()
+        fmt.Fprintf(h, "%s\x00%s\x00%s\x00%g\x00%g\x00%d\x00%d\x00",
+                cfg.Model, cfg.APIStyle, cfg.SystemPrompt, cfg.Temperature, cfg.TopP, cfg.MaxResponseTokens, len(chunks))
+        if cfg.PromptSuffix != "" {
+                fmt.Fprintf(h, "%s\x00", cfg.PromptSuffix)
+        }
+        if contextDoc != "" {
+                fmt.Fprintf(h, "%s\x00", contextDoc)
+        }
+        for _, chunk := range chunks {
+                h.Write([]byte(chunk.Text))
+                h.Write([]byte{0})
+        }
+        return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadCheckpoint returns the checkpoint for these chunks, or an empty one if
+// there is none or it was written for a different input or configuration
+func loadCheckpoint(chunks []logChunk) *checkpoint {
+        cp := &checkpoint{Key: checkpointKey(chunks), Chunks: map[int]checkpointChunk{}}
+        data, err := os.ReadFile(checkpointPath())
+        if os.IsNotExist(err) {
+                return cp
+        }
+        var saved checkpoint
+        if err == nil {
+                err = json.Unmarshal(data, &saved)
+        }
+        switch {
+        case err != nil:
+                logWarnf("Ignoring unreadable checkpoint %s: %v", checkpointPath(), err)
+        case saved.Key != cp.Key:
+                logInfof("Checkpoint %s is for a different input or configuration, starting over", checkpointPath())
+        default:
+                for idx, chunk := range saved.Chunks {
+                        if idx >= 0 && idx < len(chunks) {
+                                cp.Chunks[idx] = chunk
+                        }
+                }
+        }
+        return cp
+}
+
+// save writes the checkpoint atomically, so a crash mid-write leaves the
+// previous one intact
+func (cp *checkpoint) save() {
+        data, err := json.Marshal(cp)
+        if err == nil {
+                err = writeFileAtomic(checkpointPath(), data, 0644)
+        }
+        if err != nil {
+                logWarnf("Failed to write checkpoint %s: %v", checkpointPath(), err)
+        }
+}
+
+// remove deletes the checkpoint once every chunk has been analyzed
+func (cp *checkpoint) remove() {
+        if err := os.Remove(checkpointPath()); err != nil && !os.IsNotExist(err) {
+                logWarnf("Failed to remove checkpoint %s: %v", checkpointPath(), err)
+        }
+}
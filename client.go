@@ -0,0 +1,589 @@
+package main
+
+import (
+        "bytes"
+        "context"
+        "encoding/json"
+        "errors"
+        "fmt"
+        "html"
+        "io"
+        "net/http"
+        "os"
+        "path/filepath"
+        "regexp"
+        "strconv"
+        "strings"
+        "sync/atomic"
+        "time"
+)
+
+// Shared by every request to the AI service; per-request deadlines come from
+// the context built in postJSON. All traffic goes through this one client, so
+// replacing it (or its Transport) is enough to stub out the service.
+var httpClient = &http.Client{}
+
+var (
+        errTimedOut  = errors.New("request timed out")
+        errCancelled = errors.New("request cancelled by shutdown")
+)
+
+// TransportError is a request that got no usable HTTP response: the
+// connection failed, it timed out or a shutdown cancelled it
+type TransportError struct {
+        Err error
+}
+
+func (e *TransportError) Error() string { return e.Err.Error() }
+func (e *TransportError) Unwrap() error { return e.Err }
+
+// AIServiceError is an error the AI service reported in its response.
+// ModelUnavailable is set when the requested model doesn't exist or isn't
+// loaded, so another model may still work.
+type AIServiceError struct {
+        Status           int
+        Message          string
+        ModelUnavailable bool
+}
+
+func (e *AIServiceError) Error() string { return "Error from AI service: " + e.Message }
+
+// ParseError is a request that couldn't be encoded or a response that
+// couldn't be decoded. What says which, e.g. "parse response".
+type ParseError struct {
+        What string
+        Err  error
+}
+
+func (e *ParseError) Error() string { return fmt.Sprintf("Failed to %s: %v", e.What, e.Err) }
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// requestAnalysis sends one system/user prompt pair to the AI service and
+// returns the reply and its finish_reason. Errors are a *TransportError,
+// *AIServiceError or *ParseError. chunkNum names the -debug-dir files; pass 0
+// for requests that aren't tied to a chunk.
+func requestAnalysis(systemPrompt, userPrompt, chunkLabel string, chunkNum int) (string, string, error) {
+        return requestTurns(systemPrompt, []string{userPrompt}, chunkLabel, chunkNum)
+}
+
+// requestTurns is requestAnalysis with several user messages in one
+// conversation, as -batch sends them
+func requestTurns(systemPrompt string, userPrompts []string, chunkLabel string, chunkNum int) (string, string, error) {
+        turns := make([]chatMessage, len(userPrompts))
+        for i, prompt := range userPrompts {
+                turns[i] = chatMessage{Role: "user", Content: prompt}
+        }
+        return requestConversation(systemPrompt, turns, chunkLabel, chunkNum)
+}
+
+// chatMessage is one turn of a conversation: role is "user" or "assistant"
+type chatMessage struct {
+        Role    string
+        Content string
+}
+
+// requestConversation sends a conversation that may include earlier replies,
+// as -interactive does. When the model is unavailable the request is
+// repeated with each -model-fallback model in turn.
+func requestConversation(systemPrompt string, turns []chatMessage, chunkLabel string, chunkNum int) (string, string, error) {
+        models := append([]string{cfg.Model}, cfg.ModelFallback...)
+        for i, model := range models {
+                analysis, finishReason, err := requestWithModel(model, systemPrompt, turns, chunkLabel, chunkNum)
+                var serviceErr *AIServiceError
+                if !errors.As(err, &serviceErr) || !serviceErr.ModelUnavailable || i == len(models)-1 {
+                        if len(models) > 1 && err == nil {
+                                logDebugf("%s was analyzed by model %s", chunkLabel, model)
+                        }
+                        return analysis, finishReason, err
+                }
+                logWarnf("%s: model %s is unavailable (%v), trying %s", chunkLabel, model, err, models[i+1])
+        }
+        panic("unreachable")
+}
+
+// modelUnavailablePattern matches the errors services give for a model that
+// doesn't exist or isn't loaded
+var modelUnavailablePattern = regexp.MustCompile(`(?i)model.*(not found|not loaded|does not exist|unavailable|no such)|no models? (is |are )?loaded`)
+
+// contextDoc is the -context-file text, sent with every request after the
+// system prompt so the model knows the systems behind the logs
+var contextDoc string
+
+// contextMessage introduces contextDoc to the model
+func contextMessage() string {
+        return "Background on the systems these logs come from:\n\n" + contextDoc
+}
+
+// requestWithModel sends one request to the given model
+func requestWithModel(model, systemPrompt string, turns []chatMessage, chunkLabel string, chunkNum int) (string, string, error) {
+        // Prepare the chat API payload
+        messages := []map[string]string{
+                {
+                        "role":    "system",
+                        "content": systemPrompt,
+                },
+        }
+        if contextDoc != "" {
+                messages = append(messages, map[string]string{
+                        "role":    "system",
+                        "content": contextMessage(),
+                })
+        }
+        var prompts []string
+        for _, turn := range turns {
+                messages = append(messages, map[string]string{
+                        "role":    turn.Role,
+                        "content": turn.Content,
+                })
+                if turn.Role == "user" {
+                        prompts = append(prompts, turn.Content)
+                } else {
+                        prompts = append(prompts, turn.Role+": "+turn.Content)
+                }
+        }
+        requestBody := map[string]interface{}{
+                "model":       model,
+                "messages":    messages,
+                "temperature": cfg.Temperature,
+        }
+        userPrompt := strings.Join(prompts, "\n\n")
+        instructions := systemPrompt
+        if contextDoc != "" {
+                instructions += "\n\n" + contextMessage()
+        }
+        if cfg.APIStyle == apiCompletions {
+                // The legacy endpoint takes a single prompt instead of messages
+                delete(requestBody, "messages")
+                requestBody["prompt"] = instructions + "\n\n" + userPrompt
+        }
+        if cfg.MaxResponseTokens > 0 {
+                requestBody["max_tokens"] = cfg.MaxResponseTokens
+        }
+        if cfg.TopP > 0 {
+                requestBody["top_p"] = cfg.TopP
+        }
+        if cfg.Stream {
+                requestBody["stream"] = true
+        }
+        if cfg.JSONMode && systemPrompt == cfg.SystemPrompt {
+                // Only chunk analyses use the -system-prompt, and only they reply with findings
+                requestBody["response_format"] = map[string]string{"type": "json_object"}
+        }
+
+        requestJSON, err := json.Marshal(requestBody)
+        if err != nil {
+                return "", "", &ParseError{What: "create JSON payload", Err: err}
+        }
+        if cfg.VerbosePayload {
+                logPayload(requestBody, chunkLabel)
+        }
+
+        // Send the log entries to the AI model for analysis
+        body, status, header, err := postWithRetry(requestJSON, chunkLabel)
+        if cfg.DebugDir != "" {
+                writeDebugFiles(chunkNum, chunkLabel, model, requestJSON, body, status, err)
+        }
+        if err != nil {
+                return "", "", &TransportError{Err: err}
+        }
+
+        // Log raw response for debugging
+        logDebugf("Raw response for %s: %s", chunkLabel, string(body))
+
+        // A proxy's HTML error page says more as text than as a JSON syntax error
+        if !isJSONResponse(header, body) {
+                switch {
+                case status == http.StatusNotFound:
+                        // Usually a model the server doesn't know, with a plain text body
+                        return "", "", &AIServiceError{Status: status, Message: fmt.Sprintf("HTTP %d: %s", status, responseSnippet(body)), ModelUnavailable: true}
+                case status < 200 || status > 299:
+                        return "", "", &AIServiceError{Status: status, Message: fmt.Sprintf("HTTP %d: %s", status, responseSnippet(body))}
+                }
+                return "", "", &ParseError{What: "parse response", Err: fmt.Errorf("got %s instead of JSON: %s", contentTypeOf(header), responseSnippet(body))}
+        }
+
+        // Extract and save the AI analysis
+        var result map[string]interface{}
+        err = json.Unmarshal(body, &result)
+        if err != nil {
+                if status < 200 || status > 299 {
+                        return "", "", &AIServiceError{Status: status, Message: fmt.Sprintf("HTTP %d: %s", status, responseSnippet(body)), ModelUnavailable: status == http.StatusNotFound}
+                }
+                return "", "", &ParseError{What: "parse response", Err: err}
+        }
+
+        // Check for errors first
+        errorMsg, hasError := result["error"].(string)
+        if errorObj, ok := result["error"].(map[string]interface{}); ok {
+                errorMsg, hasError = "Unknown error", true
+                if msg, ok := errorObj["message"].(string); ok {
+                        errorMsg = msg
+                }
+        }
+        if !hasError && (status < 200 || status > 299) {
+                // Valid JSON but not a reply, e.g. a gateway's own error format
+                errorMsg, hasError = fmt.Sprintf("HTTP %d: %s", status, responseSnippet(body)), true
+        }
+        if hasError {
+                return "", "", &AIServiceError{
+                        Status:           status,
+                        Message:          errorMsg,
+                        ModelUnavailable: status == http.StatusNotFound || modelUnavailablePattern.MatchString(errorMsg),
+                }
+        }
+
+        // Extract analysis text
+        analysis, finishReason, ok := extractContent(result, cfg.APIStyle)
+        if contentPath != nil {
+                if text, found := lookupContent(result, contentPath); found {
+                        analysis, ok = text, true
+                } else if !contentPathMissed.Swap(true) {
+                        logWarnf("-content-path %s found no text in the response from the AI service; using the standard %s reply field", cfg.ContentPath, cfg.APIStyle)
+                }
+        }
+        recordUsage(result, instructions+"\n\n"+userPrompt, analysis)
+        if !ok {
+                analysis = fmt.Sprintf("No analysis received for %s.", chunkLabel)
+        }
+        return analysis, finishReason, nil
+}
+
+// isJSONResponse tells a JSON reply from an error page: either the
+// Content-Type says JSON or the body starts like it, since some servers label
+// JSON as text/plain and streamed replies arrive reassembled into JSON.
+func isJSONResponse(header http.Header, body []byte) bool {
+        if strings.Contains(strings.ToLower(header.Get("Content-Type")), "json") {
+                return true
+        }
+        trimmed := bytes.TrimSpace(body)
+        return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// contentTypeOf names a response's Content-Type for error messages
+func contentTypeOf(header http.Header) string {
+        if contentType := header.Get("Content-Type"); contentType != "" {
+                return contentType
+        }
+        return "a response without a Content-Type"
+}
+
+// htmlTagPattern matches the markup stripped from HTML error pages
+var htmlTagPattern = regexp.MustCompile(`(?s)<(script|style)\b.*?</(script|style)>|<[^>]*>`)
+
+// responseSnippet shortens an unexpected response body for an error message:
+// HTML tags are dropped, whitespace collapsed and the rest cut to 200 bytes.
+func responseSnippet(body []byte) string {
+        text := string(bytes.ToValidUTF8(body, []byte("\uFFFD")))
+        text = htmlTagPattern.ReplaceAllString(text, " ")
+        text = strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+        if text == "" {
+                return "(empty body)"
+        }
+        snippet, _ := truncateLine(text, 200)
+        return snippet
+}
+
+// extractContent pulls the reply text and finish_reason out of a response:
+// choices[0].message.content for chat, choices[0].text for completions.
+func extractContent(result map[string]interface{}, style string) (string, string, bool) {
+        choices, _ := result["choices"].([]interface{})
+        if len(choices) == 0 {
+                return "", "", false
+        }
+        choice, _ := choices[0].(map[string]interface{})
+        finishReason, _ := choice["finish_reason"].(string)
+
+        if style == apiCompletions {
+                text, ok := choice["text"].(string)
+                return text, finishReason, ok
+        }
+        message, _ := choice["message"].(map[string]interface{})
+        content, ok := message["content"].(string)
+        return content, finishReason, ok
+}
+
+// contentPath is -content-path split into keys and list indexes; nil reads
+// the standard field for -api-style. contentPathMissed keeps the fallback
+// warning to one per run.
+var (
+        contentPath       []string
+        contentPathMissed atomic.Bool
+)
+
+// parseContentPath splits a selector such as choices.0.message.content or
+// $.output[0].text into its steps. A leading "$." is accepted for
+// JSONPath habits; brackets hold list indexes.
+func parseContentPath(path string) ([]string, error) {
+        rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+        rest = strings.ReplaceAll(rest, "[", ".")
+        var steps []string
+        for _, step := range strings.Split(rest, ".") {
+                if index, ok := strings.CutSuffix(step, "]"); ok {
+                        if _, err := strconv.Atoi(index); err != nil {
+                                return nil, fmt.Errorf("list index %q is not a number", index)
+                        }
+                        step = index
+                }
+                if step == "" || strings.ContainsAny(step, "[]") {
+                        return nil, fmt.Errorf("empty or malformed step in %q", path)
+                }
+                steps = append(steps, step)
+        }
+        return steps, nil
+}
+
+// lookupContent walks steps through a decoded response; numeric steps index
+// lists and any other step is an object key. Only a non-empty string counts
+// as found.
+func lookupContent(value interface{}, steps []string) (string, bool) {
+        for _, step := range steps {
+                switch v := value.(type) {
+                case map[string]interface{}:
+                        value = v[step]
+                case []interface{}:
+                        i, err := strconv.Atoi(step)
+                        if err != nil || i < 0 || i >= len(v) {
+                                return "", false
+                        }
+                        value = v[i]
+                default:
+                        return "", false
+                }
+        }
+        text, ok := value.(string)
+        return text, ok && text != ""
+}
+
+// postWithRetry sends the payload to the AI endpoint, retrying connection
+// errors and 429/5xx responses with exponential backoff, or after the
+// Retry-After delay a 429 asks for. Other 4xx responses
+// are returned as-is since repeating a bad request won't help, and timeouts
+// are not retried since a hung model rarely recovers within the run. The
+// circuit breaker sees the request as a whole, so it only counts a failure
+// once the retries are used up.
+func postWithRetry(payload []byte, chunkLabel string) ([]byte, int, http.Header, error) {
+        if breaker != nil {
+                if err := breaker.allow(); err != nil {
+                        return nil, 0, nil, err
+                }
+        }
+        body, status, header, err := postAttempts(payload, chunkLabel)
+        if breaker != nil {
+                if errors.Is(err, errCancelled) {
+                        breaker.abandon()
+                } else {
+                        breaker.record(err != nil)
+                }
+        }
+        return body, status, header, err
+}
+
+// postAttempts makes the attempts of postWithRetry
+func postAttempts(payload []byte, chunkLabel string) ([]byte, int, http.Header, error) {
+        delay := retryBaseDelay
+        for attempt := 1; ; attempt++ {
+                // Retries count against -rpm like any other request
+                if rateLimiter != nil {
+                        if err := rateLimiter.wait(requestCtx); err != nil {
+                                return nil, 0, nil, err
+                        }
+                }
+                body, status, header, err := postJSON(payload)
+
+                var reason string
+                switch {
+                case err != nil:
+                        reason = err.Error()
+                case status == http.StatusTooManyRequests || status >= 500:
+                        reason = fmt.Sprintf("HTTP %d", status)
+                default:
+                        return body, status, header, nil
+                }
+
+                if attempt > cfg.Retries || errors.Is(err, errTimedOut) || interrupted() {
+                        if err != nil {
+                                return nil, status, header, err
+                        }
+                        // Out of retries: let the caller report whatever the server sent back
+                        return body, status, header, nil
+                }
+
+                wait := delay
+                if status == http.StatusTooManyRequests {
+                        if retryAfter, ok := parseRetryAfter(header.Get("Retry-After"), time.Now()); ok {
+                                wait = retryAfter
+                                logWarnf("%s: rate limited, honoring Retry-After of %s", chunkLabel, wait)
+                        }
+                }
+
+                logWarnf("%s: attempt %d/%d failed (%s), retrying in %s",
+                        chunkLabel, attempt, cfg.Retries+1, reason, wait)
+                // Don't sit out the backoff once a shutdown has started
+                select {
+                case <-time.After(wait):
+                case <-stopDispatch:
+                        if err != nil {
+                                return nil, status, header, err
+                        }
+                        return body, status, header, nil
+                }
+                delay *= 2
+        }
+}
+
+// parseRetryAfter reads a Retry-After header given either as delay seconds or
+// as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+        value = strings.TrimSpace(value)
+        if value == "" {
+                return 0, false
+        }
+        if seconds, err := strconv.Atoi(value); err == nil {
+                if seconds < 0 {
+                        return 0, false
+                }
+                return time.Duration(seconds) * time.Second, true
+        }
+        if at, err := http.ParseTime(value); err == nil {
+                wait := at.Sub(now)
+                if wait < 0 {
+                        wait = 0
+                }
+                return wait, true
+        }
+        return 0, false
+}
+
+// contextError explains why a request's context ended, if it did: the
+// -timeout deadline or a shutdown signal.
+func contextError(ctx context.Context) error {
+        switch {
+        case requestCtx.Err() != nil:
+                return errCancelled
+        case ctx.Err() == context.DeadlineExceeded:
+                return fmt.Errorf("%w after %gs", errTimedOut, cfg.Timeout.Seconds())
+        }
+        return nil
+}
+
+// postJSON performs a single POST of the payload and returns the response body,
+// status code and headers. The timeout covers the whole exchange, including the body.
+func postJSON(payload []byte) ([]byte, int, http.Header, error) {
+        ctx, cancel := context.WithTimeout(requestCtx, cfg.Timeout)
+        defer cancel()
+
+        req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, bytes.NewBuffer(payload))
+        if err != nil {
+                return nil, 0, nil, fmt.Errorf("Failed to create request: %v", err)
+        }
+        req.Header.Set("Content-Type", "application/json")
+        if cfg.APIKey != "" {
+                req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+        }
+
+        resp, err := httpClient.Do(req)
+        if err != nil {
+                if ctxErr := contextError(ctx); ctxErr != nil {
+                        return nil, 0, nil, ctxErr
+                }
+                return nil, 0, nil, fmt.Errorf("Failed to send request: %v", err)
+        }
+        defer resp.Body.Close()
+
+        // Servers that ignore "stream" answer with plain JSON, which is read as usual
+        if cfg.Stream && resp.StatusCode == http.StatusOK &&
+                strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+                body, err := readEventStream(resp.Body)
+                if ctxErr := contextError(ctx); err != nil && ctxErr != nil {
+                        return nil, resp.StatusCode, resp.Header, ctxErr
+                }
+                return body, resp.StatusCode, resp.Header, err
+        }
+
+        // Read the response
+        body, err := io.ReadAll(resp.Body)
+        if err != nil {
+                if ctxErr := contextError(ctx); ctxErr != nil {
+                        return nil, resp.StatusCode, resp.Header, ctxErr
+                }
+                return nil, resp.StatusCode, resp.Header, fmt.Errorf("Failed to read response: %v", err)
+        }
+        return body, resp.StatusCode, resp.Header, nil
+}
+
+// debugRequests numbers the -debug-dir files of requests not tied to a chunk
+var debugRequests atomic.Int64
+
+// debugNamePattern matches the runs of characters left out of -debug-dir
+// file names
+var debugNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// debugName turns a label or model name into a file name part
+func debugName(s string) string {
+        return strings.Trim(debugNamePattern.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// writeDebugFiles saves the raw request and response for a request under
+// -debug-dir, plus a small metadata file. The files are named after the
+// chunk, or for other requests such as the synthesis after their label and
+// a running number, and after the model, so each model fallback attempt
+// keeps its own. Failures only produce warnings.
+func writeDebugFiles(chunkNum int, chunkLabel, model string, request, response []byte, status int, sendErr error) {
+        name := fmt.Sprintf("chunk-%03d", chunkNum)
+        if chunkNum == 0 {
+                name = fmt.Sprintf("request-%03d-%s", debugRequests.Add(1), debugName(chunkLabel))
+        }
+        prefix := filepath.Join(cfg.DebugDir, name+"-"+debugName(model))
+
+        meta := map[string]interface{}{
+                "label":       chunkLabel,
+                "model":       model,
+                "http_status": status,
+        }
+        if sendErr != nil {
+                meta["error"] = sendErr.Error()
+        }
+        metaJSON, err := json.MarshalIndent(meta, "", "  ")
+        if err != nil {
+                logWarnf("Failed to encode debug metadata for %s: %v", chunkLabel, err)
+                return
+        }
+
+        files := map[string][]byte{
+                prefix + "-request.json": request,
+                prefix + "-meta.json":    metaJSON,
+        }
+        if response != nil {
+                files[prefix+"-response.json"] = response
+        } else if err := os.Remove(prefix + "-response.json"); err != nil && !os.IsNotExist(err) {
+                // Left by an earlier attempt of the same request
+                logWarnf("Failed to remove stale debug file %s-response.json: %v", prefix, err)
+        }
+        for path, data := range files {
+                if err := os.WriteFile(path, data, 0644); err != nil {
+                        logWarnf("Failed to write debug file %s: %v", path, err)
+                }
+        }
+}
+
+// logPayload logs a request body pretty-printed at DEBUG level, with the API
+// key masked should it appear anywhere in the prompts
+func logPayload(requestBody map[string]interface{}, chunkLabel string) {
+        pretty, err := json.MarshalIndent(requestBody, "", "  ")
+        if err != nil {
+                return
+        }
+        payload := string(pretty)
+        if cfg.APIKey != "" {
+                payload = strings.ReplaceAll(payload, cfg.APIKey, maskKey(cfg.APIKey))
+        }
+        logDebugf("Request payload for %s:\n%s", chunkLabel, payload)
+}
+
+// maskKey hides all but the last four characters of an API key for logging
+func maskKey(key string) string {
+        if len(key) <= 8 {
+                return strings.Repeat("*", len(key))
+        }
+        return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
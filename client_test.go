@@ -0,0 +1,300 @@
+package main
+
+import (
+        "errors"
+        "io"
+        "net/http"
+        "os"
+        "reflect"
+        "strings"
+        "sync/atomic"
+        "testing"
+        "time"
+)
+
+// roundTripFunc lets a function stand in for the AI service's transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// stubAIService points httpClient at a transport that answers every request
+// with the given response, and returns the number of requests made. The
+// client and cfg are restored when the test ends.
+func stubAIService(t *testing.T, status int, contentType, body string) *atomic.Int64 {
+        t.Helper()
+        savedCfg, savedTransport := cfg, httpClient.Transport
+        t.Cleanup(func() {
+                cfg = savedCfg
+                httpClient.Transport = savedTransport
+        })
+
+        cfg.Endpoint = "http://ai.test/v1/chat/completions"
+        cfg.APIStyle = apiChat
+        cfg.Model = "test-model"
+        cfg.ModelFallback = nil
+        cfg.Timeout = 5 * time.Second
+        cfg.Retries = 0
+
+        var requests atomic.Int64
+        httpClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+                requests.Add(1)
+                header := http.Header{}
+                if contentType != "" {
+                        header.Set("Content-Type", contentType)
+                }
+                return &http.Response{
+                        StatusCode: status,
+                        Header:     header,
+                        Body:       io.NopCloser(strings.NewReader(body)),
+                        Request:    req,
+                }, nil
+        })
+        return &requests
+}
+
+func TestRequestAnalysisResponses(t *testing.T) {
+        tests := []struct {
+                name        string
+                status      int
+                contentType string
+                body        string
+
+                wantText   string
+                wantFinish string
+                wantErr    string // "service" or "parse" for the expected error type, "" for success
+                errContent string
+        }{
+                {
+                        name:        "successful extraction",
+                        status:      http.StatusOK,
+                        contentType: "application/json",
+                        body:        `{"choices":[{"message":{"content":"- [ERROR] db: connection refused"},"finish_reason":"stop"}]}`,
+                        wantText:    "- [ERROR] db: connection refused",
+                        wantFinish:  "stop",
+                },
+                {
+                        name:        "truncated reply",
+                        status:      http.StatusOK,
+                        contentType: "application/json",
+                        body:        `{"choices":[{"message":{"content":"partial"},"finish_reason":"length"}]}`,
+                        wantText:    "partial",
+                        wantFinish:  "length",
+                },
+                {
+                        name:        "error object",
+                        status:      http.StatusOK,
+                        contentType: "application/json",
+                        body:        `{"error":{"message":"context length exceeded"}}`,
+                        wantErr:     "service",
+                        errContent:  "context length exceeded",
+                },
+                {
+                        name:        "error object without message",
+                        status:      http.StatusBadRequest,
+                        contentType: "application/json",
+                        body:        `{"error":{}}`,
+                        wantErr:     "service",
+                        errContent:  "Unknown error",
+                },
+                {
+                        name:        "error string",
+                        status:      http.StatusOK,
+                        contentType: "application/json",
+                        body:        `{"error":"invalid API key"}`,
+                        wantErr:     "service",
+                        errContent:  "invalid API key",
+                },
+                {
+                        name:        "missing choices",
+                        status:      http.StatusOK,
+                        contentType: "application/json",
+                        body:        `{"usage":{"prompt_tokens":10}}`,
+                        wantText:    "No analysis received for Part 1/1.",
+                },
+                {
+                        name:        "empty choices",
+                        status:      http.StatusOK,
+                        contentType: "application/json",
+                        body:        `{"choices":[]}`,
+                        wantText:    "No analysis received for Part 1/1.",
+                },
+                {
+                        name:        "malformed JSON",
+                        status:      http.StatusOK,
+                        contentType: "application/json",
+                        body:        `{"choices":[`,
+                        wantErr:     "parse",
+                },
+                {
+                        name:        "HTML error page",
+                        status:      http.StatusBadGateway,
+                        contentType: "text/html",
+                        body:        "<html><body><h1>502 Bad Gateway</h1></body></html>",
+                        wantErr:     "service",
+                        errContent:  "HTTP 502: 502 Bad Gateway",
+                },
+                {
+                        name:        "HTML with success status",
+                        status:      http.StatusOK,
+                        contentType: "text/html",
+                        body:        "<html><title>Sign in</title></html>",
+                        wantErr:     "parse",
+                        errContent:  "got text/html instead of JSON: Sign in",
+                },
+        }
+
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        stubAIService(t, tt.status, tt.contentType, tt.body)
+
+                        text, finish, err := requestAnalysis("system", "logs", "Part 1/1", 0)
+                        if tt.wantErr != "" {
+                                var serviceErr *AIServiceError
+                                var parseErr *ParseError
+                                switch {
+                                case tt.wantErr == "service" && !errors.As(err, &serviceErr):
+                                        t.Fatalf("error = %v (%T), want *AIServiceError", err, err)
+                                case tt.wantErr == "parse" && !errors.As(err, &parseErr):
+                                        t.Fatalf("error = %v (%T), want *ParseError", err, err)
+                                }
+                                if !strings.Contains(err.Error(), tt.errContent) {
+                                        t.Errorf("error = %q, want it to contain %q", err, tt.errContent)
+                                }
+                                return
+                        }
+                        if err != nil {
+                                t.Fatalf("unexpected error: %v", err)
+                        }
+                        if text != tt.wantText {
+                                t.Errorf("text = %q, want %q", text, tt.wantText)
+                        }
+                        if finish != tt.wantFinish {
+                                t.Errorf("finish_reason = %q, want %q", finish, tt.wantFinish)
+                        }
+                })
+        }
+}
+
+func TestRequestAnalysisCompletionsStyle(t *testing.T) {
+        stubAIService(t, http.StatusOK, "application/json", `{"choices":[{"text":"legacy reply","finish_reason":"stop"}]}`)
+        cfg.APIStyle = apiCompletions
+
+        text, _, err := requestAnalysis("system", "logs", "Part 1/1", 0)
+        if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        if text != "legacy reply" {
+                t.Errorf("text = %q, want %q", text, "legacy reply")
+        }
+}
+
+func TestRequestAnalysisModelFallback(t *testing.T) {
+        stubAIService(t, http.StatusOK, "", "")
+        cfg.ModelFallback = stringList{"backup-model"}
+
+        var models []string
+        httpClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+                body, _ := io.ReadAll(req.Body)
+                reply := `{"choices":[{"message":{"content":"from backup"},"finish_reason":"stop"}]}`
+                status := http.StatusOK
+                if strings.Contains(string(body), `"model":"test-model"`) {
+                        models = append(models, "test-model")
+                        reply, status = `{"error":{"message":"model 'test-model' not found"}}`, http.StatusNotFound
+                } else {
+                        models = append(models, "backup-model")
+                }
+                return &http.Response{
+                        StatusCode: status,
+                        Header:     http.Header{"Content-Type": {"application/json"}},
+                        Body:       io.NopCloser(strings.NewReader(reply)),
+                        Request:    req,
+                }, nil
+        })
+
+        text, _, err := requestAnalysis("system", "logs", "Part 1/1", 0)
+        if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+        }
+        if text != "from backup" {
+                t.Errorf("text = %q, want %q", text, "from backup")
+        }
+        if strings.Join(models, ",") != "test-model,backup-model" {
+                t.Errorf("models tried = %v, want test-model then backup-model", models)
+        }
+}
+
+func TestRequestAnalysisTransportError(t *testing.T) {
+        stubAIService(t, http.StatusOK, "", "")
+        httpClient.Transport = roundTripFunc(func(*http.Request) (*http.Response, error) {
+                return nil, errors.New("connection refused")
+        })
+
+        _, _, err := requestAnalysis("system", "logs", "Part 1/1", 0)
+        var transportErr *TransportError
+        if !errors.As(err, &transportErr) {
+                t.Fatalf("error = %v (%T), want *TransportError", err, err)
+        }
+}
+
+func TestBreakerCountsRequestsNotAttempts(t *testing.T) {
+        stubAIService(t, http.StatusOK, "", "")
+        var calls atomic.Int64
+        httpClient.Transport = roundTripFunc(func(*http.Request) (*http.Response, error) {
+                calls.Add(1)
+                return nil, errors.New("connection refused")
+        })
+        cfg.Retries = 1
+        saved := breaker
+        t.Cleanup(func() { breaker = saved })
+        breaker = newCircuitBreaker(1, 0)
+
+        // The retry still goes out: the breaker only counts the request once
+        // its attempts are used up
+        if _, _, err := requestAnalysis("system", "logs", "Part 1/2", 0); err == nil {
+                t.Fatal("want an error from the first request")
+        }
+        if n := calls.Load(); n != 2 {
+                t.Errorf("first request made %d attempts, want 2", n)
+        }
+        if _, _, err := requestAnalysis("system", "logs", "Part 2/2", 0); !errors.Is(err, errEndpointDown) {
+                t.Errorf("second request error = %v, want errEndpointDown", err)
+        }
+        if n := calls.Load(); n != 2 {
+                t.Errorf("%d attempts in all, want 2 with the circuit open", n)
+        }
+}
+
+func TestWriteDebugFilesNames(t *testing.T) {
+        saved := cfg
+        t.Cleanup(func() { cfg = saved })
+        cfg.DebugDir = t.TempDir()
+        debugRequests.Store(0)
+
+        writeDebugFiles(3, "Part 3/12", "llama-3.1:8b", []byte("{}"), []byte("{}"), http.StatusOK, nil)
+        writeDebugFiles(3, "Part 3/12", "backup", []byte("{}"), []byte("{}"), http.StatusOK, nil)
+        // A later attempt that got no response drops the earlier one's
+        writeDebugFiles(3, "Part 3/12", "backup", []byte("{}"), nil, 0, errors.New("connection refused"))
+        writeDebugFiles(0, "Synthesis", "llama-3.1:8b", []byte("{}"), []byte("{}"), http.StatusOK, nil)
+
+        entries, err := os.ReadDir(cfg.DebugDir)
+        if err != nil {
+                t.Fatal(err)
+        }
+        var got []string
+        for _, entry := range entries {
+                got = append(got, entry.Name())
+        }
+        want := []string{
+                "chunk-003-backup-meta.json",
+                "chunk-003-backup-request.json",
+                "chunk-003-llama-3-1-8b-meta.json",
+                "chunk-003-llama-3-1-8b-request.json",
+                "chunk-003-llama-3-1-8b-response.json",
+                "request-001-synthesis-llama-3-1-8b-meta.json",
+                "request-001-synthesis-llama-3-1-8b-request.json",
+                "request-001-synthesis-llama-3-1-8b-response.json",
+        }
+        if !reflect.DeepEqual(got, want) {
+                t.Errorf("debug files =\n%q\nwant\n%q", got, want)
+        }
+}
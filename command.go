@@ -0,0 +1,66 @@
+package main
+
+import (
+        "bytes"
+        "fmt"
+        "io"
+        "os/exec"
+        "strings"
+)
+
+// commandReader streams the output of a command run as a log source, such as
+// journalctl or ssh. Close waits for the command and reports a non-zero exit
+// as a *commandError.
+type commandReader struct {
+        name   string
+        cmd    *exec.Cmd
+        stdout io.ReadCloser
+        stderr bytes.Buffer
+}
+
+// commandError is a log source command that exited unsuccessfully
+type commandError struct {
+        Name     string
+        ExitCode int
+        Stderr   string
+}
+
+func (e *commandError) Error() string {
+        if e.Stderr != "" {
+                return fmt.Sprintf("%s failed with exit status %d: %s", e.Name, e.ExitCode, e.Stderr)
+        }
+        return fmt.Sprintf("%s failed with exit status %d", e.Name, e.ExitCode)
+}
+
+// startCommand starts cmd with its stdout available to read. name is how the
+// command is referred to in errors.
+func startCommand(cmd *exec.Cmd, name string) (*commandReader, error) {
+        c := &commandReader{name: name, cmd: cmd}
+        cmd.Stderr = &c.stderr
+        stdout, err := cmd.StdoutPipe()
+        if err != nil {
+                return nil, err
+        }
+        c.stdout = stdout
+        if err := cmd.Start(); err != nil {
+                return nil, fmt.Errorf("failed to start %s: %v", name, err)
+        }
+        return c, nil
+}
+
+func (c *commandReader) Read(p []byte) (int, error) {
+        return c.stdout.Read(p)
+}
+
+func (c *commandReader) Close() error {
+        // Closing our end first stops the command if we stopped reading early
+        c.stdout.Close()
+        err := c.cmd.Wait()
+        if exitErr, ok := err.(*exec.ExitError); ok {
+                return &commandError{Name: c.name, ExitCode: exitErr.ExitCode(), Stderr: strings.TrimSpace(c.stderr.String())}
+        }
+        if err != nil {
+                return fmt.Errorf("%s failed: %v", c.name, err)
+        }
+        return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+        "fmt"
+        "strings"
+        "time"
+)
+
+// baselineWindow is the earlier window a -compare run is measured against
+type baselineWindow struct {
+        Start   time.Time
+        End     time.Time
+        Entries []logEntry
+}
+
+// windowComparison is the model's account of what changed since the baseline
+type windowComparison struct {
+        Baseline jsonWindow `json:"baseline"`
+        Changes  string     `json:"changes"`
+}
+
+// readBaseline reads the -baseline-since/-baseline-until window with the same
+// filters as the analyzed window
+func readBaseline(filter *lineFilter) *baselineWindow {
+        start, err := time.Parse(time.RFC3339, cfg.BaselineSince)
+        if err != nil {
+                logFatalf("Invalid -baseline-since timestamp %q (want RFC3339, e.g. 2006-01-02T15:04:05Z): %v", cfg.BaselineSince, err)
+        }
+        end, err := time.Parse(time.RFC3339, cfg.BaselineUntil)
+        if err != nil {
+                logFatalf("Invalid -baseline-until timestamp %q (want RFC3339, e.g. 2006-01-02T15:04:05Z): %v", cfg.BaselineUntil, err)
+        }
+        if !end.After(start) {
+                logFatalf("-baseline-until (%s) must be after -baseline-since (%s)", cfg.BaselineUntil, cfg.BaselineSince)
+        }
+
+        baseline := &baselineWindow{Start: start.In(timeZone), End: end.In(timeZone)}
+        window := *filter
+        window.resetCounts()
+        window.Start, window.End = baseline.Start, baseline.End
+        if cfg.Journal {
+                if baseline.Entries, err = readJournal(&window, baseline.Start, baseline.End); err != nil {
+                        logFatalf("%v", err)
+                }
+        } else if baseline.Entries, err = readLogFiles(&window); err != nil {
+                logFatalf("Failed to read log file: %v", err)
+        }
+        logInfof("Found %d log lines in the baseline window %s to %s", window.InWindow,
+                baseline.Start.Format(time.RFC3339), baseline.End.Format(time.RFC3339))
+        return baseline
+}
+
+// compareWithBaseline analyzes the baseline window with the usual chunk
+// processing, then asks the model what is new or escalated in the analyses of
+// the target window. It returns nil if the comparison request fails.
+func compareWithBaseline(baseline *baselineWindow, target jsonWindow, analyses []string, tok Tokenizer) *windowComparison {
+        const systemPrompt = "You are a log analyzer comparing two time windows of the same logs. " +
+                "Report only what differs: issues that are new in the target window, issues that got more frequent or more severe, " +
+                "and issues from the baseline that stopped. Ignore issues that are unchanged."
+        const userPrompt = "BASELINE WINDOW (%s to %s):\n\n%s\n\nTARGET WINDOW (%s to %s):\n\n%s\n\n" +
+                "List what is new or escalated in the target window compared with the baseline, most serious first, " +
+                "then briefly note anything that was resolved."
+
+        baselineText := "No log entries in this window."
+        if len(baseline.Entries) > 0 {
+                logInfof("Analyzing the baseline window for -compare")
+                outcome := runChunks(prepareChunks(baseline.Entries, tok, nil), tok)
+                if len(outcome.Analyses) == 0 {
+                        logWarnf("No baseline chunk could be analyzed, skipping the comparison")
+                        return nil
+                }
+                baselineText = condenseAnalyses(outcome.Analyses, tok)
+        }
+        targetText := condenseAnalyses(analyses, tok)
+
+        logInfof("Comparing the analyzed window with the baseline")
+        changes, _, err := requestAnalysis(systemPrompt, fmt.Sprintf(userPrompt,
+                baseline.Start.Format(time.RFC3339), baseline.End.Format(time.RFC3339), baselineText,
+                target.Start.Format(time.RFC3339), target.End.Format(time.RFC3339), targetText), "Comparison", 0)
+        if err != nil {
+                logWarnf("Comparison with the baseline failed: %v", err)
+                return nil
+        }
+        return &windowComparison{Baseline: jsonWindow{Start: baseline.Start, End: baseline.End}, Changes: changes}
+}
+
+// condenseAnalyses joins the analyses of one window, synthesizing them into
+// one summary first when they would take more than half of -chunk-tokens.
+// Used for -compare and as the -interactive context.
+func condenseAnalyses(analyses []string, tok Tokenizer) string {
+        joined := strings.Join(analyses, "\n\n")
+        if tok.Estimate(joined) <= cfg.ChunkTokens/2 {
+                return joined
+        }
+        summary, err := synthesizeSummary(analyses, tok)
+        if err != nil {
+                logWarnf("Could not condense %d analyses, sending them whole: %v", len(analyses), err)
+                return joined
+        }
+        return summary
+}
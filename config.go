@@ -0,0 +1,947 @@
+package main
+
+import (
+        "flag"
+        "fmt"
+        "os"
+        "path/filepath"
+        "strings"
+        "time"
+)
+
+// Shared defaults for the analyze and recommend subcommands
+const (
+        logFilePath        = "/var/log/remote.log"
+        outputFile         = "/home/pi/log_summary.txt"
+        recommendationFile = "/home/pi/log_recommendations.txt"
+        aiEndpoint         = "http://192.168.0.161:1234/v1/chat/completions"
+        modelName          = "qwen2.5-7b-instruct-1m" // Using the model that worked in your last attempt
+        maxTokensPerChunk  = 1500                     // Much smaller to stay safely under 4096 limit
+        defaultChunkLines  = 30                       // Start with a conservative number
+        maxCharsPerSummary = 20000                    // Limit final summary size
+        defaultWindow      = 1 * time.Hour
+        defaultMaxWindow   = 7 * 24 * time.Hour
+        defaultInterval    = 5 * time.Minute
+        defaultCacheTTL    = 24 * time.Hour
+        defaultBucket      = 5 * time.Minute
+        defaultRetries     = 3
+        retryBaseDelay     = 2 * time.Second // Doubled after every failed attempt
+        defaultTimeout     = 120 * time.Second
+        defaultTemperature = 0.3         // Lower temperature for more consistent, focused responses
+        maxLineSize        = 1024 * 1024 // Longer lines are skipped while scanning
+        defaultLineLength  = 4096        // Longer lines are truncated before chunking
+
+        // Minimum gap between progress file writes when chunks finish quickly
+        progressSaveInterval = 2 * time.Second
+
+        // Bound on -synthesize reduce rounds, in case summaries stop shrinking
+        maxSynthesisLevels = 5
+
+        // How long in-flight requests get to finish after SIGINT/SIGTERM
+        shutdownGracePeriod = 10 * time.Second
+)
+
+// config holds the runtime settings shared by all subcommands. The constants
+// above are the defaults; command-line flags override them in parseFlags.
+type config struct {
+        ConfigPath    string
+        LogPaths      stringList
+        SourcePrefix  string
+        Endpoint      string
+        Model         string
+        OutputPath    string
+        Window        time.Duration
+        Since         string
+        Until         string
+        LastN         int
+        TimeLayouts   stringList
+        Retries       int
+        RPM           float64
+        Timeout       time.Duration
+        Concurrency   int
+        Batch         int
+        ChunkLines    int
+        ChunkBy       string
+        TZ            string
+        GroupBy       string
+        Bucket        time.Duration
+        MaxLineLength int
+        SampleSize    int
+        ChunkTokens   int
+        MaxChunks     int
+        MaxBytes      int
+        Overlap       int
+        Overflow      string
+        Tokenizer     string
+        MinLevel      string
+        KeepUnleveled bool
+        ContextLines  int
+        Process       string
+        PID           int
+        KeepUntagged  bool
+        Include       stringList
+        Exclude       stringList
+        Format        OutputFormat
+        DebugDir      string
+        MetricsFile   string
+        DryRun        bool
+        Synthesize    bool
+        TemplatePath  string
+        ExplainErrors bool
+
+        PriorityKeywords stringList // Most important first
+
+        SummaryPath   string // Input of the recommend pass
+        RecommendPath string // Output of the recommend pass
+
+        WebhookURL      string
+        WebhookTemplate string
+        WebhookMax      int
+
+        Dedup     bool
+        DedupMode string
+        Normalize bool
+
+        Follow   bool
+        Interval time.Duration
+        Append   bool
+
+        Interactive bool
+
+        StateFile string // Where incremental runs record how far they got
+
+        NDJSON bool
+        Resume bool
+
+        Journal bool
+        Units   stringList
+
+        NoAI bool // Extractive summary only, no AI requests
+
+        CountOnly bool // Counts by severity and template only, no AI requests
+        CountTop  int
+
+        TopErrors int // Error templates listed at the top of the summary
+
+        AnalyzeUnparsed bool
+
+        Strict       bool // Fail when more than MaxDropRatio of the lines can't be parsed
+        MaxDropRatio float64
+
+        Redact         bool
+        RedactPatterns stringList
+        Unredact       bool
+        RedactMapPath  string // -anonymize-map-out
+
+        Syslog         bool
+        SyslogFacility string
+        SyslogTag      string
+
+        Compare       bool
+        BaselineSince string
+        BaselineUntil string
+
+        Serve string // Listen address of the HTTP server mode
+
+        CacheDir string
+        CacheTTL time.Duration
+
+        JSONLogs bool
+        Logfmt   bool
+        TSField  string
+        Fields   stringList
+
+        APIKey string // Bearer token for the AI service; never log it unmasked
+
+        ModelFallback stringList // Tried in order when -model is unavailable
+
+        Temperature       float64
+        MaxResponseTokens int     // 0 leaves max_tokens to the service
+        TopP              float64 // 0 leaves top_p to the service
+        RetryTruncated    bool
+        Stream            bool
+        APIStyle          string
+
+        Preflight      bool
+        LogLevel       string
+        Quiet          bool
+        VerbosePayload bool
+
+        logLevelSet bool // -log-level was given explicitly
+
+        CPUProfile string
+        MemProfile string
+
+        SystemPrompt    string // System message for chunk analysis
+        RecommendPrompt string // System message for the recommendation pass
+
+        Stdout bool // Also print the final summary
+
+        Gzip bool // Compress the summary files whatever their names
+
+        MaxWindow time.Duration // Longest window analyzed without -force
+        Force     bool
+
+        Preprocess string // Shell command the filtered lines are piped through
+
+        JSONMode bool // Ask for chunk findings as a JSON object
+
+        BreakerThreshold int // Transport failures in a row that open the circuit
+
+        DropHealthchecks    bool
+        HealthcheckPatterns stringList // Replace defaultHealthcheckPatterns
+
+        PromptSuffix    string // Appended to each chunk's user message
+        RecommendSuffix string // Appended to the recommendation request
+
+        ContentPath string // Response field holding the reply, for non-standard backends
+
+        Every        time.Duration // Re-run the whole pipeline on this interval
+        RotateOutput bool          // Timestamp each -every pass's output files
+
+        ContextFile string // Background document sent with every request
+
+        LineFormat    string // Named-group regexp for custom text layouts
+        DropUnmatched bool
+
+        windowSet     bool // -window was given explicitly
+        outSet        bool // -out was given explicitly
+        recommendNext bool // all: recommendations follow the analysis and are the final summary
+}
+
+// Request formats for -api-style
+const (
+        apiChat        = "chat"
+        apiCompletions = "completions"
+)
+
+// OutputFormat selects how the final summary is written
+type OutputFormat string
+
+const (
+        formatText OutputFormat = "text"
+        formatJSON OutputFormat = "json"
+        formatBoth OutputFormat = "both" // Text to -out, JSON to -out with a .json suffix
+)
+
+func (f *OutputFormat) String() string {
+        return string(*f)
+}
+
+func (f *OutputFormat) Set(value string) error {
+        switch OutputFormat(value) {
+        case formatText, formatJSON, formatBoth:
+                *f = OutputFormat(value)
+                return nil
+        }
+        return fmt.Errorf("unknown format %q (want text, json or both)", value)
+}
+
+func (f OutputFormat) wantsText() bool {
+        return f == formatText || f == formatBoth
+}
+
+func (f OutputFormat) wantsJSON() bool {
+        return f == formatJSON || f == formatBoth
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+        return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+        *l = append(*l, value)
+        return nil
+}
+
+var cfg config
+
+// timeZone is the -tz location; everything time-related is shown in it
+var timeZone = time.Local
+
+// addCommonFlags registers the settings every subcommand needs to talk to the AI service
+func addCommonFlags(fs *flag.FlagSet) {
+        fs.StringVar(&cfg.ConfigPath, "config", "", "JSON or YAML file of settings keyed by flag name; command-line flags override it")
+        fs.StringVar(&cfg.Endpoint, "endpoint", aiEndpoint, "chat completions endpoint of the AI service")
+        fs.StringVar(&cfg.Model, "model", modelName, "model name to request from the AI service")
+        fs.Var(&cfg.ModelFallback, "model-fallback", "models to try in order when -model is not found or not loaded; repeat or comma-separate")
+        fs.DurationVar(&cfg.Timeout, "timeout", defaultTimeout, "maximum time for a single AI request, including reading the response")
+        fs.IntVar(&cfg.Retries, "retries", defaultRetries, "how many times to retry a request after connection errors or 429/5xx responses")
+        fs.IntVar(&cfg.BreakerThreshold, "breaker-threshold", 5, "stop sending requests after this many requests in a row failed to reach the AI service after their -retries, skipping the remaining chunks (with -follow or -every, trying again after -interval or -every; with -serve, after a minute); 0 disables")
+        fs.Float64Var(&cfg.RPM, "rpm", 0, "most requests per minute to send to the AI service, spaced evenly whatever the -concurrency; 0 is unlimited")
+        fs.StringVar(&cfg.APIKey, "api-key", "", "bearer token for the AI service (default $OPENAI_API_KEY)")
+        fs.Float64Var(&cfg.Temperature, "temperature", defaultTemperature, "sampling temperature between 0 and 2")
+        fs.IntVar(&cfg.MaxResponseTokens, "max-response-tokens", 0, "max_tokens to request per response; 0 leaves it to the service")
+        fs.Float64Var(&cfg.TopP, "top-p", 0, "nucleus sampling top_p; 0 leaves it to the service")
+        fs.BoolVar(&cfg.Stream, "stream", false, "stream replies and echo them to stderr as they arrive")
+        fs.StringVar(&cfg.APIStyle, "api-style", apiChat, "request format: chat (/v1/chat/completions) or completions (legacy /v1/completions)")
+        fs.StringVar(&cfg.ContextFile, "context-file", "", "file of background knowledge for the model, such as a runbook or service topology, sent as an extra system message with every request; counted against -chunk-tokens")
+        fs.StringVar(&cfg.ContentPath, "content-path", "", "dotted path to the reply text in the response JSON for backends that put it elsewhere, e.g. output.0.text or choices[0].message.reasoning_content; falls back to the standard field when it finds nothing (default: the -api-style field)")
+        fs.BoolVar(&cfg.Preflight, "preflight", true, "check that the AI service is reachable and accepts the API key before sending any chunks")
+        fs.StringVar(&cfg.LogLevel, "log-level", "info", "least severe log messages to show: debug, info, warn or error")
+        fs.BoolVar(&cfg.Quiet, "quiet", false, "only log errors (same as -log-level error)")
+        fs.BoolVar(&cfg.VerbosePayload, "verbose-payload", false, "log every request body, pretty-printed, at DEBUG level (implies -log-level debug unless given)")
+        fs.StringVar(&cfg.CPUProfile, "cpuprofile", "", "write a pprof CPU profile of the run to this file")
+        fs.StringVar(&cfg.MemProfile, "memprofile", "", "write a pprof heap profile to this file when the run finishes")
+}
+
+// addAnalyzeFlags registers the settings of the chunked analysis pass
+func addAnalyzeFlags(fs *flag.FlagSet) {
+        fs.Var(&cfg.LogPaths, "log", "log file to analyze; repeat or comma-separate for several, \"-\" reads from stdin, ssh://[user@]host[:port]/path streams a remote file (default "+logFilePath+")")
+        fs.StringVar(&cfg.SourcePrefix, "source-prefix", "[{source}] ", "prefix tagging each line with its file when analyzing several logs")
+        fs.StringVar(&cfg.OutputPath, "out", outputFile, "file to write the summary to")
+        fs.BoolVar(&cfg.Gzip, "gzip", false, "gzip-compress the summary files even if their names do not end in .gz")
+        fs.DurationVar(&cfg.Window, "window", defaultWindow, "how far back from now to analyze (e.g. 30m, 6h, 24h)")
+        fs.StringVar(&cfg.Since, "since", "", "start of the window as an RFC3339 timestamp (requires -until)")
+        fs.StringVar(&cfg.Until, "until", "", "end of the window as an RFC3339 timestamp (requires -since)")
+        fs.DurationVar(&cfg.MaxWindow, "max-window", defaultMaxWindow, "refuse windows longer than this (e.g. a mistyped -since) unless -force is given; 0 disables the cap")
+        fs.BoolVar(&cfg.Force, "force", false, "analyze windows longer than -max-window anyway")
+        fs.IntVar(&cfg.LastN, "last-n", 0, "ignore timestamps and analyze the last N lines of each log, like tail -n; overrides -window and -since/-until")
+        fs.Var(&cfg.TimeLayouts, "ts-layout", "extra Go time layout to try when parsing line timestamps (repeatable)")
+        fs.IntVar(&cfg.Concurrency, "concurrency", 1, "number of chunks to send to the AI service in parallel")
+        fs.IntVar(&cfg.Batch, "batch", 1, "number of chunks sent together in one request, as separate messages, while their combined estimate fits -chunk-tokens")
+        fs.IntVar(&cfg.ChunkLines, "chunk-lines", defaultChunkLines, "maximum number of log lines per chunk")
+        fs.StringVar(&cfg.ChunkBy, "chunk-by", "lines", "how to size chunks: lines (-chunk-lines, shrunk to fit -chunk-tokens) or tokens (pack lines up to -chunk-tokens)")
+        fs.IntVar(&cfg.ChunkTokens, "chunk-tokens", maxTokensPerChunk, "maximum estimated tokens per chunk")
+        fs.IntVar(&cfg.Overlap, "overlap", 0, "repeat this many lines from the end of each chunk at the start of the next, as context")
+        fs.IntVar(&cfg.MaxChunks, "max-chunks", 0, "upper bound on chunks sent to the AI service; 0 means no limit")
+        fs.IntVar(&cfg.MaxBytes, "max-bytes", 0, "upper bound on the bytes of log text sent to the AI service across all chunks; 0 means no limit")
+        fs.StringVar(&cfg.Overflow, "overflow", "sample", "which chunks to keep beyond -max-chunks or -max-bytes: sample (evenly across the window) or truncate (the first ones)")
+        fs.IntVar(&cfg.MaxLineLength, "max-line-length", defaultLineLength, "cut log lines longer than this many bytes before chunking; 0 keeps them whole")
+        fs.IntVar(&cfg.SampleSize, "unparsed-sample", 5, "how many randomly chosen lines without a usable timestamp to show in the summary's parse warnings")
+        fs.BoolVar(&cfg.AnalyzeUnparsed, "analyze-unparsed", false, "send lines without a usable timestamp to the model too, instead of only counting them")
+        fs.BoolVar(&cfg.Strict, "strict", false, "fail with exit code 1 if more than -max-drop-ratio of the non-empty lines have no usable timestamp")
+        fs.Float64Var(&cfg.MaxDropRatio, "max-drop-ratio", 0.1, "largest fraction of unparseable lines -strict accepts, between 0 and 1")
+        fs.StringVar(&cfg.TZ, "tz", "Local", "time zone for the window, log timestamps without an offset, and the summary: UTC, Local or an IANA name such as Europe/Berlin")
+        fs.StringVar(&cfg.Tokenizer, "tokenizer", "chardiv", "token estimator used to size chunks: chardiv or wordpunct")
+        fs.StringVar(&cfg.MinLevel, "min-level", "debug", "drop lines below this severity: debug, info, warn, error or fatal")
+        fs.BoolVar(&cfg.KeepUnleveled, "keep-unleveled", false, "keep lines with no detectable severity regardless of -min-level")
+        fs.StringVar(&cfg.Process, "process", "", "keep only lines whose syslog tag (the program in \"host sshd[123]:\") is this name")
+        fs.IntVar(&cfg.PID, "pid", 0, "keep only lines whose syslog tag has this PID")
+        fs.BoolVar(&cfg.KeepUntagged, "keep-untagged", false, "keep lines without a syslog tag when -process or -pid is set")
+        fs.IntVar(&cfg.ContextLines, "context-lines", 0, "also keep up to N lines before and after each line that passes -min-level, like grep -C")
+        fs.Var(&cfg.Include, "include", "only keep lines matching this regular expression (repeatable, OR-combined)")
+        fs.Var(&cfg.Exclude, "exclude", "drop lines matching this regular expression (repeatable, OR-combined)")
+        fs.StringVar(&cfg.Preprocess, "preprocess", "", "shell command to pipe the filtered lines of each log through before chunking; its output replaces them")
+        cfg.Format = formatText
+        fs.Var(&cfg.Format, "format", "summary format: text, json, or both (JSON goes to the -out path plus .json)")
+        fs.StringVar(&cfg.DebugDir, "debug-dir", "", "directory to save the raw requests and responses in, per chunk and model")
+        fs.StringVar(&cfg.CacheDir, "cache-dir", "", "directory to cache chunk analyses in, so unchanged chunks aren't sent to the model again")
+        fs.DurationVar(&cfg.CacheTTL, "cache-ttl", defaultCacheTTL, "how long cached analyses stay valid; 0 keeps them forever")
+        fs.Var(&cfg.PriorityKeywords, "priority-keywords", "words marking the analyses to keep first when the summary is too long, most important first; repeat or comma-separate (default CRITICAL,FATAL,ERROR)")
+        fs.DurationVar(&cfg.Bucket, "bucket", defaultBucket, "bucket size of the log volume histogram at the top of the summary")
+        fs.IntVar(&cfg.TopErrors, "top-errors", 0, "list the N most frequent error messages, grouped with numbers and IDs masked, at the top of the summary; 0 disables")
+        fs.StringVar(&cfg.GroupBy, "group-by", "", "arrange the summary's findings: component groups them per component; empty keeps chunk order")
+        fs.StringVar(&cfg.MetricsFile, "metrics-file", "", "write run metrics in Prometheus text format to this file, e.g. for node_exporter's textfile collector")
+        fs.BoolVar(&cfg.DryRun, "dry-run", false, "report how the logs would be chunked without calling the AI service or writing output")
+        fs.BoolVar(&cfg.Synthesize, "synthesize", false, "have the model write a meta-summary of all chunk analyses")
+        fs.StringVar(&cfg.TemplatePath, "template", "", "text/template file to render the text summary with instead of the built-in layout")
+        fs.BoolVar(&cfg.ExplainErrors, "explain-errors", false, "ask the model to explain chunk errors and suggest a fix")
+        fs.BoolVar(&cfg.DropHealthchecks, "drop-healthchecks", false, "collapse runs of health-check, readiness and metrics request lines into one line counting them")
+        fs.Var(&cfg.HealthcheckPatterns, "healthcheck-pattern", "regular expression for a -drop-healthchecks line, replacing the built-in list of /healthz, /ready, /metrics and probe user agents (repeatable)")
+        fs.BoolVar(&cfg.Dedup, "dedup", false, "collapse repeated lines into one annotated with its count")
+        fs.StringVar(&cfg.DedupMode, "dedup-mode", "exact", "what counts as a repeat for -dedup: exact, or normalized to also ignore numbers and IDs")
+        fs.BoolVar(&cfg.Normalize, "normalize", false, "mask numbers, UUIDs and IP addresses so the model sees event templates")
+        fs.BoolVar(&cfg.RetryTruncated, "retry-truncated", false, "re-analyze a chunk in two halves when the model's reply is cut off")
+        fs.BoolVar(&cfg.Follow, "follow", false, "keep running and re-analyze the most recent -window every -interval")
+        fs.StringVar(&cfg.StateFile, "state-file", "", "record the newest line and file offsets after each successful run, and start the next run after them instead of -window")
+        fs.BoolVar(&cfg.Interactive, "interactive", false, "after the summary, answer questions about the logs typed on stdin; the answers are appended to -out")
+        fs.DurationVar(&cfg.Interval, "interval", defaultInterval, "time between analyses with -follow")
+        fs.DurationVar(&cfg.Every, "every", 0, "instead of exiting, re-read the logs and run the whole analysis (with all, the recommendations too) on the most recent -window at this interval until stopped")
+        fs.BoolVar(&cfg.RotateOutput, "rotate-output", false, "with -every, write each pass to a copy of -out (and -recommend-out) named after its start time instead of replacing them")
+        fs.BoolVar(&cfg.Append, "append", false, "append each summary to -out instead of replacing it")
+        fs.BoolVar(&cfg.Resume, "resume", false, "checkpoint finished chunks to the -out path plus .checkpoint, and skip those already there from an earlier run")
+        fs.BoolVar(&cfg.NDJSON, "ndjson", false, "print each chunk result as a JSON line on stdout; summary files are only written if -out is given")
+        fs.BoolVar(&cfg.Journal, "journal", false, "read the systemd journal for the window via journalctl instead of -log files")
+        fs.Var(&cfg.Units, "unit", "with -journal, only read entries of this systemd unit; repeat or comma-separate for several")
+        fs.BoolVar(&cfg.JSONLogs, "json-logs", false, "parse each line as a JSON object instead of plain text")
+        fs.BoolVar(&cfg.Logfmt, "logfmt", false, "parse key=value (logfmt) lines, passing lines that aren't logfmt through as plain text")
+        fs.StringVar(&cfg.LineFormat, "line-format", "", "regular expression with named groups ts and msg, and optionally level and component, for text logs in a custom layout, e.g. '^(?P<level>\\w+) (?P<component>\\S+) (?P<ts>\\S+) (?P<msg>.*)'; lines it doesn't match are read as plain text")
+        fs.BoolVar(&cfg.DropUnmatched, "drop-unmatched", false, "with -line-format, drop lines it doesn't match, continuation lines such as stack traces included")
+        fs.StringVar(&cfg.TSField, "ts-field", "ts", "field holding the timestamp in -json-logs and -logfmt mode (-logfmt also tries ts and time)")
+        fs.Var(&cfg.Fields, "fields", "fields to send to the model in -json-logs and -logfmt mode; repeat or comma-separate (default all)")
+        fs.StringVar(&cfg.SystemPrompt, "system-prompt", "", "system prompt for chunk analysis, inline or @file to read it from a file")
+        fs.StringVar(&cfg.PromptSuffix, "prompt-suffix", "", "standing instructions appended to every chunk's request, inline or @file; counted against -chunk-tokens")
+        fs.BoolVar(&cfg.JSONMode, "json-mode", false, "ask the model for each chunk's findings as JSON (response_format json_object) instead of tagged prose")
+        fs.BoolVar(&cfg.Redact, "redact", false, "replace IP addresses, email addresses and hostnames with stable tokens such as <IP-1> before lines are sent to the model")
+        fs.Var(&cfg.RedactPatterns, "redact-pattern", "with -redact, also mask matches of this NAME=REGEXP, as <NAME-n> tokens (repeatable)")
+        fs.BoolVar(&cfg.Unredact, "unredact", false, "with -redact, put the original values back into the written summary")
+        fs.StringVar(&cfg.RedactMapPath, "anonymize-map-out", "", "with -redact, write the token to original value mapping as JSON to this file (mode 0600) after the run")
+        fs.BoolVar(&cfg.CountOnly, "count-only", false, "don't call the AI service; report line counts by severity and the most frequent message templates, as text or with -format json")
+        fs.IntVar(&cfg.CountTop, "count-top", 10, "how many message templates -count-only lists")
+        fs.BoolVar(&cfg.NoAI, "no-ai", false, "don't call the AI service; write a local summary of line counts by severity and the most repeated lines instead")
+        fs.BoolVar(&cfg.Syslog, "syslog", false, "also send the text summary to the local syslog, split into several messages if it is long")
+        fs.StringVar(&cfg.SyslogFacility, "syslog-facility", "user", "syslog facility for -syslog, e.g. user, daemon or local0 to local7")
+        fs.StringVar(&cfg.SyslogTag, "syslog-tag", "log-analyzer", "syslog tag (program name) for -syslog")
+        addSinkFlags(fs)
+        fs.BoolVar(&cfg.Compare, "compare", false, "also analyze the -baseline-since/-baseline-until window and report what is new or escalated in the analyzed window")
+        fs.StringVar(&cfg.BaselineSince, "baseline-since", "", "start of the -compare baseline window as an RFC3339 timestamp")
+        fs.StringVar(&cfg.BaselineUntil, "baseline-until", "", "end of the -compare baseline window as an RFC3339 timestamp")
+        fs.StringVar(&cfg.Serve, "serve", "", "run an HTTP server on this address (e.g. :8080) instead of a one-shot analysis: POST /analyze returns the JSON summary, GET /healthz reports liveness")
+}
+
+// addRecommendFlags registers the settings of the recommendation pass. When it
+// runs after analyze in the same invocation its input is analyze's -out, so
+// -in is only offered standalone.
+func addRecommendFlags(fs *flag.FlagSet, standalone bool) {
+        if standalone {
+                fs.StringVar(&cfg.SummaryPath, "in", outputFile, "summary file written by the analyze subcommand")
+        }
+        fs.StringVar(&cfg.RecommendPath, "recommend-out", recommendationFile, "file to write the summary with recommendations to")
+        fs.StringVar(&cfg.RecommendPrompt, "recommend-prompt", "", "system prompt for the recommendation pass, inline or @file to read it from a file")
+        fs.StringVar(&cfg.RecommendSuffix, "recommend-suffix", "", "standing instructions appended to the recommendation request, inline or @file")
+        if standalone {
+                addSinkFlags(fs)
+        }
+}
+
+// addSinkFlags registers the flags for the output sinks the final summary
+// goes to: the analysis with analyze, the recommendations otherwise
+func addSinkFlags(fs *flag.FlagSet) {
+        fs.BoolVar(&cfg.Stdout, "stdout", false, "also print the summary on stdout")
+        fs.StringVar(&cfg.WebhookURL, "webhook-url", "", "also POST the summary to this webhook (Slack, Discord or generic)")
+        fs.StringVar(&cfg.WebhookTemplate, "webhook-template", "", "text/template for the webhook JSON payload, inline or @file; .Text is the message (default {\"text\": {{json .Text}}})")
+        fs.IntVar(&cfg.WebhookMax, "webhook-max", defaultWebhookMax, "longest webhook message in characters; longer summaries are sent as several messages")
+}
+
+// parseFlags parses a subcommand's arguments and validates the result
+func parseFlags(fs *flag.FlagSet, args []string) {
+        // Flag errors exit with exitFatal rather than the flag package's 2,
+        // which is reserved for partial failure
+        if err := fs.Parse(args); err != nil {
+                if err == flag.ErrHelp {
+                        os.Exit(exitOK)
+                }
+                os.Exit(exitFatal)
+        }
+        if cfg.ConfigPath != "" {
+                applyConfigFile(fs, cfg.ConfigPath)
+        }
+        fs.Visit(func(f *flag.Flag) {
+                switch f.Name {
+                case "window":
+                        cfg.windowSet = true
+                case "out":
+                        cfg.outSet = true
+                case "log-level":
+                        cfg.logLevelSet = true
+                }
+        })
+        if cfg.VerbosePayload && !cfg.logLevelSet {
+                cfg.LogLevel = "debug"
+        }
+        if !setupLogging(cfg.LogLevel, cfg.Quiet) {
+                logFatalf("Invalid -log-level %q (want debug, info, warn or error)", cfg.LogLevel)
+        }
+
+        // Catch this here rather than letting every request fail with an obscure HTTP error
+        if strings.TrimSpace(cfg.Endpoint) == "" {
+                logFatalf("No AI endpoint configured: -endpoint must not be empty")
+        }
+        cfg.ModelFallback = splitList(cfg.ModelFallback)
+        if cfg.Timeout <= 0 {
+                logFatalf("-timeout must be a positive duration, got %s", cfg.Timeout)
+        }
+        if cfg.Retries < 0 {
+                logFatalf("-retries must not be negative, got %d", cfg.Retries)
+        }
+        if cfg.RPM < 0 {
+                logFatalf("-rpm must not be negative, got %g", cfg.RPM)
+        }
+        if cfg.RPM > 0 {
+                rateLimiter = newTokenBucket(cfg.RPM)
+        }
+        if cfg.BreakerThreshold < 0 {
+                logFatalf("-breaker-threshold must not be negative, got %d", cfg.BreakerThreshold)
+        }
+        if cfg.BreakerThreshold > 0 {
+                // A single run gives up on a dead endpoint; -follow tries it again
+                // each cycle, and -serve for later requests
+                var cooldown time.Duration
+                switch {
+                case cfg.Follow:
+                        cooldown = cfg.Interval
+                case cfg.Every > 0:
+                        cooldown = cfg.Every
+                case cfg.Serve != "":
+                        cooldown = serveBreakerCooldown
+                }
+                breaker = newCircuitBreaker(cfg.BreakerThreshold, cooldown)
+        }
+        if cfg.Temperature < 0 || cfg.Temperature > 2 {
+                logFatalf("-temperature must be between 0 and 2, got %g", cfg.Temperature)
+        }
+        if cfg.MaxResponseTokens < 0 {
+                logFatalf("-max-response-tokens must not be negative, got %d", cfg.MaxResponseTokens)
+        }
+        if cfg.TopP < 0 || cfg.TopP > 1 {
+                logFatalf("-top-p must be between 0 and 1, got %g", cfg.TopP)
+        }
+        switch cfg.APIStyle {
+        case apiChat:
+        case apiCompletions:
+                // Point a chat endpoint at its legacy sibling; any other URL is used as given
+                if strings.HasSuffix(cfg.Endpoint, "/chat/completions") {
+                        cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/chat/completions") + "/completions"
+                        logInfof("Using completions endpoint %s", cfg.Endpoint)
+                }
+        default:
+                logFatalf("Invalid -api-style %q (want chat or completions)", cfg.APIStyle)
+        }
+        if cfg.ContentPath != "" {
+                // Streamed replies are rebuilt in the standard shape, so there is nothing else to select
+                if cfg.Stream {
+                        logFatalf("-content-path cannot be combined with -stream")
+                }
+                steps, err := parseContentPath(cfg.ContentPath)
+                if err != nil {
+                        logFatalf("Invalid -content-path %q: %v", cfg.ContentPath, err)
+                }
+                contentPath = steps
+        }
+
+        // Read the key from the environment here rather than as the flag default
+        // so it never shows up in -h output
+        if cfg.APIKey == "" {
+                cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+        }
+        if cfg.APIKey != "" {
+                logInfof("Authenticating to the AI service with API key %s", maskKey(cfg.APIKey))
+        }
+
+        cfg.SystemPrompt = loadPrompt("-system-prompt", cfg.SystemPrompt, defaultSystemPrompt)
+        cfg.RecommendPrompt = loadPrompt("-recommend-prompt", cfg.RecommendPrompt, defaultRecommendPrompt)
+        if cfg.ContextFile != "" {
+                data, err := os.ReadFile(cfg.ContextFile)
+                if err != nil {
+                        logFatalf("Failed to read -context-file: %v", err)
+                }
+                contextDoc = strings.TrimSpace(string(data))
+                if contextDoc == "" {
+                        logFatalf("-context-file %s is empty", cfg.ContextFile)
+                }
+        }
+
+        // Resolve relative output paths against the current working directory
+        for _, path := range []*string{&cfg.OutputPath, &cfg.RecommendPath} {
+                if *path == "" {
+                        continue
+                }
+                abs, err := filepath.Abs(*path)
+                if err != nil {
+                        logFatalf("Failed to resolve output path %q: %v", *path, err)
+                }
+                *path = abs
+        }
+}
+
+// loadPrompt resolves a prompt flag. A value starting with @ names a file to
+// read the prompt from; an empty value means the built-in default.
+func loadPrompt(name, value, fallback string) string {
+        if value == "" {
+                return fallback
+        }
+        if !strings.HasPrefix(value, "@") {
+                return value
+        }
+        data, err := os.ReadFile(value[1:])
+        if err != nil {
+                logFatalf("Failed to read %s file: %v", name, err)
+        }
+        // Editors leave a trailing newline that would otherwise end up in the payload
+        prompt := strings.TrimRight(string(data), "\r\n")
+        if strings.TrimSpace(prompt) == "" {
+                logFatalf("%s file %s is empty", name, value[1:])
+        }
+        return prompt
+}
+
+// splitList flattens repeated flag values that may themselves be comma-separated
+func splitList(values stringList) stringList {
+        var out stringList
+        for _, value := range values {
+                for _, item := range strings.Split(value, ",") {
+                        if item = strings.TrimSpace(item); item != "" {
+                                out = append(out, item)
+                        }
+                }
+        }
+        return out
+}
+
+// checkRecommendFlags finishes validating the recommend settings
+func checkRecommendFlags() {
+        checkSinkFlags()
+        cfg.RecommendSuffix = loadPrompt("-recommend-suffix", cfg.RecommendSuffix, "")
+        if len(cfg.RecommendSuffix) > 50000 {
+                logFatalf("-recommend-suffix is %d bytes; keep it under 50000 so the summary still fits", len(cfg.RecommendSuffix))
+        }
+}
+
+// checkSinkFlags validates the -webhook settings
+func checkSinkFlags() {
+        if cfg.WebhookURL == "" {
+                return
+        }
+        if cfg.WebhookMax < 1 {
+                logFatalf("-webhook-max must be at least 1, got %d", cfg.WebhookMax)
+        }
+        text := loadPrompt("-webhook-template", cfg.WebhookTemplate, defaultWebhookTemplate)
+        if err := loadWebhookTemplate(text); err != nil {
+                logFatalf("Invalid -webhook-template: %v", err)
+        }
+}
+
+// checkAnalyzeFlags finishes validating the analyze settings
+func checkAnalyzeFlags() {
+        // Accept both repeated -log flags and comma-separated lists
+        cfg.LogPaths = splitList(cfg.LogPaths)
+        cfg.Units = splitList(cfg.Units)
+        checkSinkFlags()
+        cfg.PromptSuffix = loadPrompt("-prompt-suffix", cfg.PromptSuffix, "")
+        if cfg.Stdout && cfg.NDJSON {
+                logFatalf("-stdout can't be combined with -ndjson, which prints the chunk results on stdout")
+        }
+        if cfg.Journal {
+                if len(cfg.LogPaths) > 0 {
+                        logFatalf("-journal reads the systemd journal and can't be combined with -log")
+                }
+                if cfg.Follow {
+                        logFatalf("-follow needs log files; it can't follow the journal")
+                }
+                if cfg.LastN > 0 {
+                        logFatalf("-last-n reads the end of -log files and can't be combined with -journal")
+                }
+        } else if len(cfg.Units) > 0 {
+                logFatalf("-unit only applies with -journal")
+        }
+        if len(cfg.LogPaths) == 0 && !cfg.Journal {
+                cfg.LogPaths = stringList{logFilePath}
+        }
+        cfg.Fields = splitList(cfg.Fields)
+        cfg.PriorityKeywords = splitList(cfg.PriorityKeywords)
+        if len(cfg.PriorityKeywords) == 0 {
+                cfg.PriorityKeywords = stringList{"CRITICAL", "FATAL", "ERROR"}
+        }
+        if cfg.NDJSON && !cfg.outSet {
+                cfg.OutputPath = ""
+        }
+        if cfg.StateFile != "" {
+                switch {
+                case cfg.Follow || cfg.Serve != "" || cfg.Compare || cfg.LastN > 0:
+                        logFatalf("-state-file can't be combined with -follow, -serve, -compare or -last-n")
+                case cfg.Since != "":
+                        logWarnf("-since given with -state-file; starting at -since instead of after the last run")
+                }
+        }
+        if cfg.Interactive {
+                switch {
+                case cfg.Follow || cfg.Serve != "" || cfg.NDJSON || cfg.DryRun || cfg.NoAI:
+                        logFatalf("-interactive can't be combined with -follow, -serve, -ndjson, -dry-run or -no-ai")
+                case !cfg.Format.wantsText():
+                        logFatalf("-interactive appends to the text summary, so it needs -format text or both")
+                }
+                for _, path := range cfg.LogPaths {
+                        if path == "-" {
+                                logFatalf("-interactive reads questions from stdin, so the log can't come from stdin")
+                        }
+                }
+        }
+        if cfg.LastN < 0 {
+                logFatalf("-last-n must not be negative, got %d", cfg.LastN)
+        }
+        if cfg.LastN > 0 {
+                if cfg.Follow {
+                        logFatalf("-last-n ignores time and can't be combined with -follow")
+                }
+                if cfg.windowSet || cfg.Since != "" || cfg.Until != "" {
+                        logWarnf("-last-n given together with a time window; ignoring the window")
+                }
+        }
+        if cfg.Syslog {
+                checkSyslogFlags()
+        }
+        if cfg.Redact {
+                r, err := newRedactor(cfg.RedactPatterns)
+                if err != nil {
+                        logFatalf("Invalid -redact-pattern %v", err)
+                }
+                redactions = r
+        } else if len(cfg.RedactPatterns) > 0 || cfg.Unredact || cfg.RedactMapPath != "" {
+                logFatalf("-redact-pattern, -unredact and -anonymize-map-out only apply with -redact")
+        }
+        if cfg.TopErrors < 0 {
+                logFatalf("-top-errors must not be negative, got %d", cfg.TopErrors)
+        }
+        if cfg.CountOnly {
+                if cfg.NoAI {
+                        logFatalf("-count-only and -no-ai are alternatives; pick one")
+                }
+                if cfg.CountTop < 1 {
+                        logFatalf("-count-top must be at least 1, got %d", cfg.CountTop)
+                }
+                // Everything that skips the model for -no-ai applies as well
+                cfg.NoAI = true
+        }
+        if cfg.NoAI {
+                switch {
+                case cfg.Format != formatText && !cfg.CountOnly:
+                        logFatalf("-no-ai writes a text summary and needs -format text")
+                case cfg.NDJSON || cfg.Compare || cfg.Serve != "":
+                        logFatalf("-no-ai can't be combined with -ndjson, -compare or -serve")
+                }
+        }
+        if cfg.Compare {
+                switch {
+                case cfg.BaselineSince == "" || cfg.BaselineUntil == "":
+                        logFatalf("-compare needs the baseline window as -baseline-since and -baseline-until")
+                case cfg.Follow || cfg.Serve != "" || cfg.LastN > 0:
+                        logFatalf("-compare can't be combined with -follow, -serve or -last-n")
+                case cfg.NDJSON || cfg.Resume:
+                        // The baseline goes through the same chunk pipeline, which
+                        // would stream its records and share the checkpoint
+                        logFatalf("-compare can't be combined with -ndjson or -resume")
+                }
+        } else if cfg.BaselineSince != "" || cfg.BaselineUntil != "" {
+                logFatalf("-baseline-since and -baseline-until only apply with -compare")
+        }
+        if cfg.Serve != "" {
+                switch {
+                case cfg.Follow, cfg.Resume, cfg.NDJSON, cfg.DryRun, cfg.Append:
+                        logFatalf("-serve can't be combined with -follow, -resume, -ndjson, -dry-run or -append")
+                case cfg.Journal:
+                        logFatalf("-serve reads -log files or the request body, not the journal")
+                }
+                if cfg.outSet {
+                        logWarnf("-serve returns summaries in the HTTP response; ignoring -out")
+                }
+                cfg.OutputPath = ""
+        }
+        if cfg.Every < 0 {
+                logFatalf("-every must not be negative, got %s", cfg.Every)
+        }
+        if cfg.Every > 0 {
+                switch {
+                case cfg.Follow || cfg.Serve != "" || cfg.Interactive || cfg.Resume:
+                        logFatalf("-every can't be combined with -follow, -serve, -interactive or -resume")
+                case cfg.Since != "" || cfg.Until != "":
+                        logFatalf("-every analyzes the most recent -window each pass and can't be combined with -since/-until")
+                }
+                for _, path := range cfg.LogPaths {
+                        if path == "-" {
+                                logFatalf("-every re-reads the logs each pass, so they can't come from stdin")
+                        }
+                }
+        } else if cfg.RotateOutput {
+                logFatalf("-rotate-output only applies with -every")
+        }
+        if cfg.Follow {
+                if cfg.Since != "" || cfg.Until != "" {
+                        logFatalf("-follow analyzes a rolling -window and can't be combined with -since/-until")
+                }
+                if cfg.Interval <= 0 {
+                        logFatalf("-interval must be a positive duration, got %s", cfg.Interval)
+                }
+                for _, path := range cfg.LogPaths {
+                        if path == "-" {
+                                logFatalf("-follow needs log files; it can't follow stdin")
+                        }
+                        if isSSHPath(path) {
+                                logFatalf("-follow needs local log files; it can't follow %s", path)
+                        }
+                }
+        }
+        loc, err := time.LoadLocation(cfg.TZ)
+        if err != nil {
+                logFatalf("Invalid -tz %q: %v", cfg.TZ, err)
+        }
+        timeZone = loc
+        if cfg.Resume {
+                if cfg.OutputPath == "" {
+                        logFatalf("-resume keeps its checkpoint next to the summary, so it needs -out with -ndjson")
+                }
+                if cfg.Follow {
+                        logFatalf("-resume can't be combined with -follow")
+                }
+        }
+        if cfg.JSONLogs && cfg.Logfmt {
+                logFatalf("-json-logs and -logfmt can't be combined")
+        }
+        if cfg.LineFormat != "" {
+                if cfg.JSONLogs || cfg.Logfmt {
+                        logFatalf("-line-format can't be combined with -json-logs or -logfmt")
+                }
+        } else if cfg.DropUnmatched {
+                logFatalf("-drop-unmatched only applies with -line-format")
+        }
+        if (cfg.JSONLogs || cfg.Logfmt) && strings.TrimSpace(cfg.TSField) == "" {
+                logFatalf("-ts-field must not be empty with -json-logs or -logfmt")
+        }
+
+        if cfg.DebugDir != "" {
+                if err := os.MkdirAll(cfg.DebugDir, 0755); err != nil {
+                        logWarnf("Failed to create debug directory %s: %v", cfg.DebugDir, err)
+                }
+        }
+        if cfg.CacheTTL < 0 {
+                logFatalf("-cache-ttl must not be negative, got %s", cfg.CacheTTL)
+        }
+        if cfg.CacheDir != "" {
+                cache, err := newChunkCache(cfg.CacheDir, cfg.CacheTTL)
+                if err != nil {
+                        logWarnf("Failed to create cache directory %s, caching disabled: %v", cfg.CacheDir, err)
+                } else {
+                        analysisCache = cache
+                }
+        }
+        if cfg.Concurrency < 1 {
+                logFatalf("-concurrency must be at least 1, got %d", cfg.Concurrency)
+        }
+        if cfg.SampleSize < 0 {
+                logFatalf("-unparsed-sample must not be negative, got %d", cfg.SampleSize)
+        }
+        if cfg.MaxDropRatio < 0 || cfg.MaxDropRatio > 1 {
+                logFatalf("-max-drop-ratio must be between 0 and 1, got %g", cfg.MaxDropRatio)
+        }
+        if cfg.PID < 0 {
+                logFatalf("-pid must not be negative, got %d", cfg.PID)
+        }
+        if cfg.KeepUntagged && cfg.Process == "" && cfg.PID == 0 {
+                logWarnf("-keep-untagged has no effect without -process or -pid")
+        }
+        if cfg.ContextLines < 0 {
+                logFatalf("-context-lines must not be negative, got %d", cfg.ContextLines)
+        }
+        if cfg.ContextLines > 0 && strings.EqualFold(cfg.MinLevel, "debug") {
+                logWarnf("-context-lines has no effect without -min-level: no lines are dropped by severity")
+        }
+        if cfg.Batch < 1 {
+                logFatalf("-batch must be at least 1, got %d", cfg.Batch)
+        }
+        if cfg.JSONMode {
+                switch {
+                case cfg.Batch > 1:
+                        logFatalf("-json-mode can't be combined with -batch, whose replies hold several labeled analyses")
+                case cfg.APIStyle == apiCompletions:
+                        logFatalf("-json-mode needs the chat API; the legacy completions endpoint has no response_format")
+                }
+                cfg.SystemPrompt += " " + findingJSONPrompt
+        }
+        if cfg.ChunkLines < 1 {
+                logFatalf("-chunk-lines must be at least 1, got %d", cfg.ChunkLines)
+        }
+        if cfg.ChunkTokens < 1 {
+                logFatalf("-chunk-tokens must be at least 1, got %d", cfg.ChunkTokens)
+        }
+        if cfg.PromptSuffix != "" || contextDoc != "" {
+                // Both go out with every chunk, so they come out of the chunk budget
+                tokenizer, err := newTokenizer(cfg.Tokenizer)
+                if err != nil {
+                        logFatalf("Invalid -tokenizer: %v", err)
+                }
+                budget := cfg.ChunkTokens
+                if cfg.PromptSuffix != "" {
+                        suffixTokens := tokenizer.Estimate(cfg.PromptSuffix)
+                        if suffixTokens >= cfg.ChunkTokens {
+                                logFatalf("-prompt-suffix is about %d tokens, which leaves nothing of -chunk-tokens %d for the logs", suffixTokens, cfg.ChunkTokens)
+                        }
+                        cfg.ChunkTokens -= suffixTokens
+                        logInfof("-prompt-suffix takes about %d tokens, leaving %d per chunk for the logs", suffixTokens, cfg.ChunkTokens)
+                }
+                if contextDoc != "" {
+                        contextTokens := tokenizer.Estimate(contextDoc)
+                        if contextTokens >= cfg.ChunkTokens {
+                                logFatalf("-context-file %s is about %d tokens, which leaves nothing of -chunk-tokens %d for the logs", cfg.ContextFile, contextTokens, cfg.ChunkTokens)
+                        }
+                        if contextTokens*4 > budget {
+                                logWarnf("-context-file %s is about %d tokens, more than a quarter of -chunk-tokens %d; each chunk carries that many fewer log lines", cfg.ContextFile, contextTokens, budget)
+                        }
+                        cfg.ChunkTokens -= contextTokens
+                        logInfof("-context-file takes about %d tokens, leaving %d per chunk for the logs", contextTokens, cfg.ChunkTokens)
+                }
+        }
+        if cfg.MaxLineLength < 0 {
+                logFatalf("-max-line-length must not be negative, got %d", cfg.MaxLineLength)
+        }
+        if cfg.Overlap < 0 {
+                logFatalf("-overlap must not be negative, got %d", cfg.Overlap)
+        }
+        if cfg.MaxChunks < 0 {
+                logFatalf("-max-chunks must not be negative, got %d", cfg.MaxChunks)
+        }
+        if cfg.MaxBytes < 0 {
+                logFatalf("-max-bytes must not be negative, got %d", cfg.MaxBytes)
+        }
+        if cfg.Bucket <= 0 {
+                logFatalf("-bucket must be a positive duration, got %s", cfg.Bucket)
+        }
+        if cfg.GroupBy != "" && cfg.GroupBy != "component" {
+                logFatalf("Invalid -group-by %q (want component)", cfg.GroupBy)
+        }
+        if cfg.ChunkBy != "lines" && cfg.ChunkBy != "tokens" {
+                logFatalf("Invalid -chunk-by %q (want lines or tokens)", cfg.ChunkBy)
+        }
+        if cfg.Overflow != "sample" && cfg.Overflow != "truncate" {
+                logFatalf("Invalid -overflow %q (want sample or truncate)", cfg.Overflow)
+        }
+        if len(cfg.HealthcheckPatterns) > 0 && !cfg.DropHealthchecks {
+                logWarnf("-healthcheck-pattern has no effect without -drop-healthchecks")
+        }
+        if cfg.DedupMode != "exact" && cfg.DedupMode != "normalized" {
+                logFatalf("Invalid -dedup-mode %q (want exact or normalized)", cfg.DedupMode)
+        }
+
+        if cfg.TemplatePath != "" {
+                if err := loadSummaryTemplate(cfg.TemplatePath); err != nil {
+                        logFatalf("Failed to load -template %s: %v", cfg.TemplatePath, err)
+                }
+        }
+
+        if len(cfg.TimeLayouts) > 0 {
+                timestampLayouts = append(append([]string{}, cfg.TimeLayouts...), timestampLayouts...)
+        }
+}
+
+// resolveWindow works out the time range to analyze. Explicit -since/-until
+// timestamps take precedence over -window.
+func resolveWindow(now time.Time) (time.Time, time.Time, error) {
+        if cfg.Since == "" && cfg.Until == "" {
+                if cfg.Window <= 0 {
+                        return time.Time{}, time.Time{}, fmt.Errorf("-window must be a positive duration, got %s", cfg.Window)
+                }
+                return now.Add(-cfg.Window), now, nil
+        }
+        if cfg.Since == "" || cfg.Until == "" {
+                return time.Time{}, time.Time{}, fmt.Errorf("-since and -until must be used together")
+        }
+
+        if cfg.windowSet {
+                logWarnf("-since/-until given together with -window; using the explicit timestamps")
+        }
+
+        since, err := time.Parse(time.RFC3339, cfg.Since)
+        if err != nil {
+                return time.Time{}, time.Time{}, fmt.Errorf("invalid -since timestamp %q (want RFC3339, e.g. 2006-01-02T15:04:05Z): %v", cfg.Since, err)
+        }
+        until, err := time.Parse(time.RFC3339, cfg.Until)
+        if err != nil {
+                return time.Time{}, time.Time{}, fmt.Errorf("invalid -until timestamp %q (want RFC3339, e.g. 2006-01-02T15:04:05Z): %v", cfg.Until, err)
+        }
+        if !until.After(since) {
+                return time.Time{}, time.Time{}, fmt.Errorf("-until (%s) must be after -since (%s)", cfg.Until, cfg.Since)
+        }
+        return since.In(timeZone), until.In(timeZone), nil
+}
+
+// checkWindowSize rejects a window longer than -max-window, so a mistyped
+// -since does not read months of logs and send them all to the model
+func checkWindowSize(start, end time.Time) error {
+        if cfg.Force || cfg.MaxWindow <= 0 || end.Sub(start) <= cfg.MaxWindow {
+                return nil
+        }
+        return fmt.Errorf("the window from %s to %s is %s long, more than -max-window %s; pass -force to analyze it anyway",
+                start.Format(time.RFC3339), end.Format(time.RFC3339), end.Sub(start).Round(time.Second), cfg.MaxWindow)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+        "bufio"
+        "bytes"
+        "encoding/json"
+        "flag"
+        "fmt"
+        "os"
+        "path/filepath"
+        "strconv"
+        "strings"
+)
+
+// applyConfigFile fills in settings from a -config file. Keys are flag names
+// (with - or _), so the file can hold anything the command line can. Flags
+// given on the command line win over the file, which wins over the defaults.
+func applyConfigFile(fs *flag.FlagSet, path string) {
+        settings, err := loadConfigFile(path)
+        if err != nil {
+                logFatalf("Failed to load config file %s: %v", path, err)
+        }
+
+        explicit := map[string]bool{}
+        fs.Visit(func(f *flag.Flag) {
+                explicit[f.Name] = true
+        })
+
+        for _, s := range settings {
+                name := strings.ReplaceAll(s.Key, "_", "-")
+                if name == "config" || fs.Lookup(name) == nil {
+                        logWarnf("Unknown key %q in config file %s", s.Key, path)
+                        continue
+                }
+                if explicit[name] {
+                        continue
+                }
+                for _, value := range s.Values {
+                        if err := fs.Set(name, value); err != nil {
+                                logFatalf("Invalid value %q for %s in config file %s: %v", value, s.Key, path, err)
+                        }
+                }
+        }
+}
+
+// configSetting is one key of a config file. List keys have several values.
+type configSetting struct {
+        Key    string
+        Values []string
+}
+
+// loadConfigFile reads a JSON or YAML config file, picked by its extension
+func loadConfigFile(path string) ([]configSetting, error) {
+        data, err := os.ReadFile(path)
+        if err != nil {
+                return nil, err
+        }
+        switch strings.ToLower(filepath.Ext(path)) {
+        case ".json":
+                return parseJSONConfig(data)
+        case ".yaml", ".yml":
+                return parseYAMLConfig(data)
+        default:
+                return nil, fmt.Errorf("unsupported extension %q (want .json, .yaml or .yml)", filepath.Ext(path))
+        }
+}
+
+func parseJSONConfig(data []byte) ([]configSetting, error) {
+        var raw map[string]interface{}
+        if err := json.Unmarshal(data, &raw); err != nil {
+                return nil, err
+        }
+        var settings []configSetting
+        for key, value := range raw {
+                var values []string
+                if list, ok := value.([]interface{}); ok {
+                        for _, item := range list {
+                                values = append(values, jsonScalar(item))
+                        }
+                } else {
+                        values = []string{jsonScalar(value)}
+                }
+                settings = append(settings, configSetting{Key: key, Values: values})
+        }
+        return settings, nil
+}
+
+func jsonScalar(value interface{}) string {
+        switch v := value.(type) {
+        case string:
+                return v
+        case float64:
+                return strconv.FormatFloat(v, 'f', -1, 64)
+        case bool:
+                return strconv.FormatBool(v)
+        case nil:
+                return ""
+        default:
+                data, _ := json.Marshal(v)
+                return string(data)
+        }
+}
+
+// parseYAMLConfig understands the flat subset of YAML a settings file needs:
+// "key: value" pairs, # comments, quoted strings, [a, b] and "- item" lists,
+// and "|" blocks for multi-line values such as prompts.
+func parseYAMLConfig(data []byte) ([]configSetting, error) {
+        var settings []configSetting
+        var current *configSetting // Key whose list items or block lines follow
+        inBlock := false
+        var block []string
+        blockIndent := -1
+
+        flushBlock := func() {
+                if inBlock {
+                        current.Values = []string{strings.TrimRight(strings.Join(block, "\n"), "\n")}
+                        inBlock, block, blockIndent = false, nil, -1
+                }
+        }
+
+        scanner := bufio.NewScanner(bytes.NewReader(data))
+        lineNum := 0
+        for scanner.Scan() {
+                lineNum++
+                raw := strings.TrimRight(scanner.Text(), " \t\r")
+                indent := len(raw) - len(strings.TrimLeft(raw, " "))
+
+                if inBlock {
+                        if raw == "" {
+                                block = append(block, "")
+                                continue
+                        }
+                        if indent > 0 && (blockIndent < 0 || indent >= blockIndent) {
+                                if blockIndent < 0 {
+                                        blockIndent = indent
+                                }
+                                block = append(block, raw[blockIndent:])
+                                continue
+                        }
+                        flushBlock()
+                }
+
+                line := strings.TrimSpace(stripYAMLComment(raw))
+                if line == "" || line == "---" {
+                        continue
+                }
+
+                if strings.HasPrefix(line, "- ") || line == "-" {
+                        if current == nil {
+                                return nil, fmt.Errorf("line %d: list item without a key", lineNum)
+                        }
+                        current.Values = append(current.Values, yamlScalar(strings.TrimSpace(strings.TrimPrefix(line, "-"))))
+                        continue
+                }
+                if indent > 0 {
+                        return nil, fmt.Errorf("line %d: nested mappings are not supported", lineNum)
+                }
+
+                colon := strings.Index(line, ":")
+                if colon <= 0 {
+                        return nil, fmt.Errorf("line %d: expected \"key: value\"", lineNum)
+                }
+                key := strings.TrimSpace(line[:colon])
+                value := strings.TrimSpace(line[colon+1:])
+                settings = append(settings, configSetting{Key: key})
+                current = &settings[len(settings)-1]
+
+                switch {
+                case value == "":
+                        // A list or nothing follows
+                case value == "|" || value == "|-":
+                        inBlock = true
+                case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+                        for _, item := range splitYAMLFlow(value[1 : len(value)-1]) {
+                                if item = strings.TrimSpace(item); item != "" {
+                                        current.Values = append(current.Values, yamlScalar(item))
+                                }
+                        }
+                default:
+                        current.Values = []string{yamlScalar(value)}
+                }
+        }
+        if err := scanner.Err(); err != nil {
+                return nil, err
+        }
+        flushBlock()
+        return settings, nil
+}
+
+// stripYAMLComment drops a trailing # comment that isn't inside quotes
+func stripYAMLComment(line string) string {
+        var quote rune
+        for i, r := range line {
+                switch {
+                case quote != 0:
+                        if r == quote {
+                                quote = 0
+                        }
+                case r == '"' || r == '\'':
+                        quote = r
+                case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+                        return line[:i]
+                }
+        }
+        return line
+}
+
+// splitYAMLFlow splits the items of a [a, b] flow list on the commas that
+// aren't inside quotes, tracking quotes like stripYAMLComment
+func splitYAMLFlow(list string) []string {
+        var items []string
+        var quote rune
+        start := 0
+        for i, r := range list {
+                switch {
+                case quote != 0:
+                        if r == quote {
+                                quote = 0
+                        }
+                case r == '"' || r == '\'':
+                        quote = r
+                case r == ',':
+                        items = append(items, list[start:i])
+                        start = i + 1
+                }
+        }
+        return append(items, list[start:])
+}
+
+func yamlScalar(value string) string {
+        if len(value) >= 2 {
+                if value[0] == '"' && value[len(value)-1] == '"' {
+                        if unquoted, err := strconv.Unquote(value); err == nil {
+                                return unquoted
+                        }
+                }
+                if value[0] == '\'' && value[len(value)-1] == '\'' {
+                        return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+                }
+        }
+        return value
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+        "reflect"
+        "sort"
+        "testing"
+)
+
+func TestParseYAMLConfig(t *testing.T) {
+        data := []byte(`# analyzer settings
+---
+model: "llama-3"   # trailing comment
+window: 30m
+redact: true
+include: ['a,b', "x{1,3}", plain]
+exclude:
+  - health # probes
+  - "quoted # not a comment"
+  - 'it''s'
+prompt-suffix: |
+  Focus on the database.
+
+  Ignore the cache.
+chunk-tokens: 4000
+`)
+        want := []configSetting{
+                {Key: "model", Values: []string{"llama-3"}},
+                {Key: "window", Values: []string{"30m"}},
+                {Key: "redact", Values: []string{"true"}},
+                {Key: "include", Values: []string{"a,b", "x{1,3}", "plain"}},
+                {Key: "exclude", Values: []string{"health", "quoted # not a comment", "it's"}},
+                {Key: "prompt-suffix", Values: []string{"Focus on the database.\n\nIgnore the cache."}},
+                {Key: "chunk-tokens", Values: []string{"4000"}},
+        }
+        got, err := parseYAMLConfig(data)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if !reflect.DeepEqual(got, want) {
+                t.Errorf("parseYAMLConfig =\n%q\nwant\n%q", got, want)
+        }
+}
+
+func TestParseYAMLConfigErrors(t *testing.T) {
+        tests := []struct {
+                name string
+                data string
+        }{
+                {"list item without a key", "- orphan\n"},
+                {"nested mapping", "limits:\n  tokens: 5\n"},
+                {"no colon", "just words\n"},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        if _, err := parseYAMLConfig([]byte(tt.data)); err == nil {
+                                t.Errorf("parseYAMLConfig(%q) succeeded, want an error", tt.data)
+                        }
+                })
+        }
+}
+
+func TestParseJSONConfig(t *testing.T) {
+        data := []byte(`{"model": "llama-3", "chunk_tokens": 4000, "temperature": 0.25, "redact": true,
+                "include": ["a,b", "x{1,3}"], "prompt-suffix": null}`)
+        want := []configSetting{
+                {Key: "chunk_tokens", Values: []string{"4000"}},
+                {Key: "include", Values: []string{"a,b", "x{1,3}"}},
+                {Key: "model", Values: []string{"llama-3"}},
+                {Key: "prompt-suffix", Values: []string{""}},
+                {Key: "redact", Values: []string{"true"}},
+                {Key: "temperature", Values: []string{"0.25"}},
+        }
+        got, err := parseJSONConfig(data)
+        if err != nil {
+                t.Fatal(err)
+        }
+        // Keys come out in map order
+        sort.Slice(got, func(i, j int) bool { return got[i].Key < got[j].Key })
+        if !reflect.DeepEqual(got, want) {
+                t.Errorf("parseJSONConfig =\n%q\nwant\n%q", got, want)
+        }
+
+        if _, err := parseJSONConfig([]byte(`["not", "an", "object"]`)); err == nil {
+                t.Error("parseJSONConfig accepted a JSON array")
+        }
+}
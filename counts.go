@@ -0,0 +1,139 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "strings"
+        "time"
+)
+
+// lineCounts is the -count-only report: the filtered lines counted by
+// severity and by message template, with no request to the model
+type lineCounts struct {
+        Window     jsonWindow     `json:"window"`
+        Entries    int            `json:"entries"`
+        BySeverity map[string]int `json:"by_severity"`
+        Templates  []repeatedLine `json:"top_templates"`
+}
+
+// countLines builds the -count-only report over the entries, listing the top
+// most frequent templates
+func countLines(entries []logEntry, start, end time.Time, top int) lineCounts {
+        counts := lineCounts{
+                Window:     jsonWindow{Start: start, End: end},
+                Entries:    len(entries),
+                BySeverity: map[string]int{},
+        }
+        for _, s := range extractiveSeverities {
+                counts.BySeverity[s.Label] = 0
+        }
+        lines := make([]string, len(entries))
+        for i, entry := range entries {
+                lines[i] = entry.Text
+                head, _, _ := strings.Cut(entry.Text, "\n")
+                counts.BySeverity[severityLabel(lineSeverity(head))]++
+        }
+        counts.Templates = repeatedLines(lines, nil)
+        if len(counts.Templates) > top {
+                counts.Templates = counts.Templates[:top]
+        }
+        return counts
+}
+
+// severityLabel names a severity as the -no-ai and -count-only reports do
+func severityLabel(severity int) string {
+        for _, s := range extractiveSeverities {
+                if s.Severity == severity {
+                        return s.Label
+                }
+        }
+        return "NONE"
+}
+
+// text renders the counts as tables
+func (c lineCounts) text() string {
+        var b strings.Builder
+        b.WriteString("# LOG COUNTS\n")
+        fmt.Fprintf(&b, "Generated on %s\n\n", time.Now().In(timeZone).Format(time.RFC1123))
+        fmt.Fprintf(&b, "%d log entries from %s to %s.\n\n", c.Entries, c.Window.Start.Format(time.RFC3339), c.Window.End.Format(time.RFC3339))
+        b.WriteString("## LINES BY SEVERITY\n\n| Severity | Count |\n|----------|-------|\n")
+        for _, s := range extractiveSeverities {
+                fmt.Fprintf(&b, "| %-8s | %5d |\n", s.Label, c.BySeverity[s.Label])
+        }
+
+        b.WriteString("\n## TOP MESSAGE TEMPLATES\n\n")
+        if len(c.Templates) == 0 {
+                b.WriteString("No log entries.\n")
+                return b.String()
+        }
+        b.WriteString("| Count | Template |\n|-------|----------|\n")
+        for _, t := range c.Templates {
+                fmt.Fprintf(&b, "| %5d | %s |\n", t.Count, strings.ReplaceAll(t.Template, "|", `\|`))
+        }
+        return b.String()
+}
+
+// writeLineCounts implements -count-only: it sends the counts to the
+// analysis sinks as text and writes them as JSON with -format json or both
+func writeLineCounts(entries []logEntry, start, end time.Time, stats *runStats) {
+        logInfof("Counting %d log entries locally (-count-only)", len(entries))
+        counts := countLines(entries, start, end, cfg.CountTop)
+
+        stats.finish()
+        if cfg.MetricsFile != "" {
+                writeMetricsFile(cfg.MetricsFile, stats, time.Now())
+        }
+        if cfg.Format.wantsJSON() && cfg.OutputPath != "" {
+                data, err := json.MarshalIndent(counts, "", "  ")
+                if err == nil {
+                        err = writeOutput(jsonOutputPath(), append(data, '\n'))
+                }
+                if err != nil {
+                        logErrorf("Failed to write JSON output file: %v", err)
+                } else {
+                        logInfof("Log counts saved to %s", jsonOutputPath())
+                }
+        }
+        if writeSinks(analysisSinks(), Summary{Title: "log counts", Text: counts.text()}) == 0 && cfg.OutputPath != "" && cfg.Format.wantsText() {
+                logInfof("Log counts saved to %s", cfg.OutputPath)
+        }
+}
+
+// topErrorRows ranks the n most frequent error and fatal messages among the
+// entries for -top-errors
+func topErrorRows(entries []logEntry, n int) []topErrorRow {
+        if n == 0 {
+                return nil
+        }
+        lines := make([]string, len(entries))
+        for i, entry := range entries {
+                lines[i] = entry.Text
+                // The table goes into the summary, webhooks and the recommendation request
+                if redactions != nil && !cfg.Unredact {
+                        lines[i] = redactions.redactLine(lines[i])
+                }
+        }
+        repeated := repeatedLines(lines, func(head string) bool {
+                return lineSeverity(head) >= severityError
+        })
+        if len(repeated) > n {
+                repeated = repeated[:n]
+        }
+        seen := func(t time.Time) string {
+                if t.IsZero() {
+                        return "-"
+                }
+                return t.In(timeZone).Format(time.RFC3339)
+        }
+        rows := make([]topErrorRow, len(repeated))
+        for i, r := range repeated {
+                rows[i] = topErrorRow{
+                        Rank:    i + 1,
+                        Count:   r.Count,
+                        First:   seen(r.First),
+                        Last:    seen(r.Last),
+                        Message: strings.ReplaceAll(maskedTokenPattern.ReplaceAllString(r.Template, "<$1>"), "|", `\|`),
+                }
+        }
+        return rows
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+        "errors"
+        "fmt"
+        "strings"
+)
+
+// Error categories, in the order they are reported
+var errorCategories = []string{"connection", "timeout", "parse", "ai-service", "endpoint-down", "cancelled", "other"}
+
+// errorCategory sorts a chunk error into one of errorCategories by its type
+func errorCategory(err error) string {
+        var transportErr *TransportError
+        var serviceErr *AIServiceError
+        var parseErr *ParseError
+        switch {
+        case errors.Is(err, errEndpointDown):
+                return "endpoint-down"
+        case errors.Is(err, errTimedOut):
+                return "timeout"
+        case errors.Is(err, errCancelled):
+                return "cancelled"
+        case errors.As(err, &transportErr):
+                return "connection"
+        case errors.As(err, &serviceErr):
+                return "ai-service"
+        case errors.As(err, &parseErr):
+                return "parse"
+        }
+        return categorizeError(err.Error())
+}
+
+// categorizeError sorts a chunk error message into one of errorCategories
+// by the wording the client uses for each failure. It is for messages read
+// back from a JSON summary, where the error types are gone.
+func categorizeError(msg string) string {
+        lower := strings.ToLower(msg)
+        switch {
+        case strings.Contains(lower, "endpoint down"):
+                return "endpoint-down"
+        case strings.Contains(lower, "timed out"):
+                return "timeout"
+        case strings.Contains(lower, "cancelled by shutdown"):
+                return "cancelled"
+        case strings.Contains(lower, "error from ai service"):
+                return "ai-service"
+        case strings.Contains(lower, "failed to parse"), strings.Contains(lower, "json payload"):
+                return "parse"
+        case strings.Contains(lower, "failed to send"), strings.Contains(lower, "failed to read response"),
+                strings.Contains(lower, "failed to create request"), strings.Contains(lower, "connection"):
+                return "connection"
+        }
+        return "other"
+}
+
+// describeErrorCounts summarizes errors as e.g. "12 connection errors, 2 parse errors"
+func describeErrorCounts(errs []error) string {
+        counts := map[string]int{}
+        for _, err := range errs {
+                counts[errorCategory(err)]++
+        }
+        return describeCategoryCounts(counts)
+}
+
+// describeErrorMessages is describeErrorCounts for error messages
+func describeErrorMessages(messages []string) string {
+        counts := map[string]int{}
+        for _, msg := range messages {
+                counts[categorizeError(msg)]++
+        }
+        return describeCategoryCounts(counts)
+}
+
+func describeCategoryCounts(counts map[string]int) string {
+        var parts []string
+        for _, category := range errorCategories {
+                switch n := counts[category]; n {
+                case 0:
+                case 1:
+                        parts = append(parts, fmt.Sprintf("1 %s error", category))
+                default:
+                        parts = append(parts, fmt.Sprintf("%d %s errors", n, category))
+                }
+        }
+        return strings.Join(parts, ", ")
+}
+
+// explainErrors asks the model for a short explanation of the chunk errors
+// and their likely fix (-explain-errors).
+func explainErrors(errs []error) (string, error) {
+        const systemPrompt = "You are a system administrator assistant helping debug a log analysis tool " +
+                "that sends log chunks to an AI service."
+        userPrompt := fmt.Sprintf("These errors occurred while sending log chunks to the AI service (%s). "+
+                "In one short paragraph, explain the most likely cause and how to fix it:\n\n%s",
+                describeErrorCounts(errs), strings.Join(dedupStrings(errorMessages(errs)), "\n"))
+
+        logInfof("Asking the model to explain the chunk errors")
+        explanation, _, err := requestAnalysis(systemPrompt, userPrompt, "Error explanation", 0)
+        return explanation, err
+}
+
+// errorMessages is the text of each error, as written to the summary
+func errorMessages(errs []error) []string {
+        messages := make([]string, len(errs))
+        for i, err := range errs {
+                messages[i] = err.Error()
+        }
+        return messages
+}
+
+// dedupStrings drops repeated strings, keeping the first occurrence order
+func dedupStrings(values []string) []string {
+        seen := map[string]bool{}
+        var out []string
+        for _, v := range values {
+                if !seen[v] {
+                        seen[v] = true
+                        out = append(out, v)
+                }
+        }
+        return out
+}
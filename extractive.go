@@ -0,0 +1,134 @@
+package main
+
+import (
+        "fmt"
+        "sort"
+        "strings"
+        "time"
+)
+
+// maxRepeatedLines is how many of the most repeated lines the -no-ai summary lists
+const maxRepeatedLines = 20
+
+// Severity labels for the -no-ai summary, most severe first
+var extractiveSeverities = []struct {
+        Severity int
+        Label    string
+}{
+        {severityFatal, "FATAL"},
+        {severityError, "ERROR"},
+        {severityWarn, "WARN"},
+        {severityInfo, "INFO"},
+        {severityDebug, "DEBUG"},
+        {severityUnknown, "NONE"},
+}
+
+// repeatedLine is one line template and where it occurred
+type repeatedLine struct {
+        Template string    `json:"template"`
+        Example  string    `json:"example"`
+        Count    int       `json:"count"`
+        First    time.Time `json:"first_seen"` // Zero when none of the lines has a timestamp
+        Last     time.Time `json:"last_seen"`
+}
+
+// writeExtractiveSummary implements -no-ai: it sends the extractive summary
+// of the entries to the analysis sinks
+func writeExtractiveSummary(entries []logEntry, stats *runStats) {
+        lines := make([]string, len(entries))
+        for i, entry := range entries {
+                lines[i] = entry.Text
+        }
+        logInfof("Summarizing %d log entries locally (-no-ai)", len(lines))
+        summary := extractiveSummary(lines)
+
+        stats.finish()
+        if cfg.MetricsFile != "" {
+                writeMetricsFile(cfg.MetricsFile, stats, time.Now())
+        }
+        if writeSinks(analysisSinks(), Summary{Title: "log summary", Text: summary}) == 0 && cfg.OutputPath != "" {
+                logInfof("Log summary saved to %s", cfg.OutputPath)
+        }
+}
+
+// extractiveSummary summarizes log lines without a model: how many there are
+// of each severity, and the most repeated lines, with numbers and IDs masked,
+// with when each first and last occurred.
+func extractiveSummary(lines []string) string {
+        severities := map[int]int{}
+        var first, last time.Time
+        for _, line := range lines {
+                head, _, _ := strings.Cut(line, "\n")
+                severities[lineSeverity(head)]++
+                if t, ok := parseLogTimestamp(head); ok {
+                        if first.IsZero() || t.Before(first) {
+                                first = t
+                        }
+                        if t.After(last) {
+                                last = t
+                        }
+                }
+        }
+        repeated := repeatedLines(lines, nil)
+
+        var b strings.Builder
+        b.WriteString("# LOG SUMMARY (no AI)\n")
+        fmt.Fprintf(&b, "Generated on %s\n\n", time.Now().In(timeZone).Format(time.RFC1123))
+        fmt.Fprintf(&b, "%d log entries", len(lines))
+        if !first.IsZero() {
+                fmt.Fprintf(&b, " from %s to %s", first.Format(time.RFC3339), last.Format(time.RFC3339))
+        }
+        b.WriteString(".\n\n---\n\n## LINES BY SEVERITY\n\n| Severity | Count |\n|----------|-------|\n")
+        for _, s := range extractiveSeverities {
+                fmt.Fprintf(&b, "| %-8s | %5d |\n", s.Label, severities[s.Severity])
+        }
+
+        b.WriteString("\n---\n\n## MOST REPEATED LINES\n\n")
+        if len(repeated) > maxRepeatedLines {
+                repeated = repeated[:maxRepeatedLines]
+        }
+        for i, r := range repeated {
+                fmt.Fprintf(&b, "%d. (x%d) %s\n", i+1, r.Count, r.Example)
+                if !r.First.IsZero() {
+                        fmt.Fprintf(&b, "   first %s, last %s\n", r.First.Format(time.RFC3339), r.Last.Format(time.RFC3339))
+                }
+        }
+        return b.String()
+}
+
+// repeatedLines groups lines by their first line's message with numbers and
+// IDs masked, most frequent first. keep, if set, picks the lines to count by
+// their first line.
+func repeatedLines(lines []string, keep func(head string) bool) []repeatedLine {
+        index := map[string]int{}
+        var repeated []repeatedLine
+        for _, line := range lines {
+                head, _, _ := strings.Cut(line, "\n")
+                if keep != nil && !keep(head) {
+                        continue
+                }
+                t, message, ok := splitLogTimestamp(head)
+                message = strings.TrimSpace(message)
+                key := normalizeMessage(message)
+                i, seen := index[key]
+                if !seen {
+                        i = len(repeated)
+                        index[key] = i
+                        repeated = append(repeated, repeatedLine{Template: key, Example: message})
+                }
+                r := &repeated[i]
+                r.Count++
+                if ok {
+                        if r.First.IsZero() || t.Before(r.First) {
+                                r.First = t
+                        }
+                        if t.After(r.Last) {
+                                r.Last = t
+                        }
+                }
+        }
+        sort.SliceStable(repeated, func(i, j int) bool {
+                return repeated[i].Count > repeated[j].Count
+        })
+        return repeated
+}
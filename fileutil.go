@@ -0,0 +1,128 @@
+package main
+
+import (
+        "bytes"
+        "compress/gzip"
+        "io"
+        "os"
+        "path/filepath"
+        "strings"
+        "time"
+)
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers such as the recommend pass never see a half-written
+// file. The temporary file is removed if anything fails.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+        tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+        if err != nil {
+                return err
+        }
+        tmpPath := tmp.Name()
+
+        _, err = tmp.Write(data)
+        if err == nil {
+                err = tmp.Sync()
+        }
+        if closeErr := tmp.Close(); err == nil {
+                err = closeErr
+        }
+        // CreateTemp uses 0600; apply the intended permissions before the rename
+        if err == nil {
+                err = os.Chmod(tmpPath, perm)
+        }
+        if err == nil {
+                err = os.Rename(tmpPath, path)
+        }
+        if err != nil {
+                os.Remove(tmpPath)
+        }
+        return err
+}
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gzipOutput reports whether summaries written to path are compressed: with
+// -gzip, or when the name ends in .gz
+func gzipOutput(path string) bool {
+        return cfg.Gzip || strings.HasSuffix(path, ".gz")
+}
+
+// encodeOutput compresses data for path if gzipOutput says so. Each call
+// produces a complete gzip member, and concatenated members read back as one
+// stream, so -append keeps the file valid.
+func encodeOutput(path string, data []byte) ([]byte, error) {
+        if !gzipOutput(path) {
+                return data, nil
+        }
+        var buffer bytes.Buffer
+        zw := gzip.NewWriter(&buffer)
+        if _, err := zw.Write(data); err != nil {
+                return nil, err
+        }
+        if err := zw.Close(); err != nil {
+                return nil, err
+        }
+        return buffer.Bytes(), nil
+}
+
+// rotatedPath inserts a timestamp before the extension of path, keeping a
+// .gz suffix last, e.g. summary.txt.gz becomes summary-20240102T150405.txt.gz.
+// An empty path stays empty.
+func rotatedPath(path string, at time.Time) string {
+        if path == "" {
+                return ""
+        }
+        base, gz := strings.CutSuffix(path, ".gz")
+        ext := filepath.Ext(base)
+        rotated := strings.TrimSuffix(base, ext) + "-" + at.Format("20060102T150405") + ext
+        if gz {
+                rotated += ".gz"
+        }
+        return rotated
+}
+
+// replaceOutput atomically replaces path with data, compressed if needed.
+// Progress saves rewrite the whole stream each time, so the file is valid
+// gzip after every one of them.
+func replaceOutput(path string, data []byte) error {
+        data, err := encodeOutput(path, data)
+        if err != nil {
+                return err
+        }
+        return writeFileAtomic(path, data, 0644)
+}
+
+// appendOutput adds data to the end of path, creating it if needed, as a new
+// gzip member if the file is compressed
+func appendOutput(path string, data []byte) error {
+        data, err := encodeOutput(path, data)
+        if err != nil {
+                return err
+        }
+        file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+        if err != nil {
+                return err
+        }
+        _, err = file.Write(data)
+        if closeErr := file.Close(); err == nil {
+                err = closeErr
+        }
+        return err
+}
+
+// readOutput reads a summary file, decompressing it if it starts with the
+// gzip magic bytes whatever its name
+func readOutput(path string) ([]byte, error) {
+        data, err := os.ReadFile(path)
+        if err != nil || !bytes.HasPrefix(data, gzipMagic) {
+                return data, err
+        }
+        zr, err := gzip.NewReader(bytes.NewReader(data))
+        if err != nil {
+                return nil, err
+        }
+        defer zr.Close()
+        return io.ReadAll(zr)
+}
@@ -0,0 +1,583 @@
+package main
+
+import (
+        "fmt"
+        "io"
+        "math/rand"
+        "path/filepath"
+        "regexp"
+        "strconv"
+        "strings"
+        "time"
+        "unicode/utf8"
+)
+
+// Timestamp layouts tried in order by parseLogTimestamp. Layouts given with
+// -ts-layout are tried before these. Fractional seconds of any precision,
+// after a dot or a comma, are accepted by every layout without listing them.
+var timestampLayouts = []string{
+        time.RFC3339,
+        time.RFC3339Nano,
+        time.Stamp,                 // classic syslog: "Jan  2 15:04:05"
+        "2006-01-02T15:04:05",      // ISO8601 without a zone
+        "2006-01-02T15:04:05-0700", // journalctl -o short-iso
+
+        // The same with a space instead of the T, as Python logging and log4j write them
+        "2006-01-02 15:04:05Z07:00",
+        "2006-01-02 15:04:05-0700",
+        "2006-01-02 15:04:05",
+}
+
+// parseLogTimestamp extracts the timestamp at the start of a log line, trying
+// each layout in timestampLayouts and returning the first that matches.
+func parseLogTimestamp(line string) (time.Time, bool) {
+        t, _, ok := splitLogTimestamp(line)
+        return t, ok
+}
+
+// splitLogTimestamp is parseLogTimestamp that also returns the rest of the
+// line after the timestamp.
+func splitLogTimestamp(line string) (time.Time, string, bool) {
+        for _, layout := range timestampLayouts {
+                // Compare the same number of whitespace-separated fields as the layout has
+                prefix := leadingFields(line, len(strings.Fields(layout)))
+                if prefix == "" {
+                        continue
+                }
+                // Timestamps without an offset are taken to be in -tz
+                t, err := time.ParseInLocation(layout, prefix, timeZone)
+                if err != nil {
+                        continue
+                }
+
+                // Syslog timestamps carry no year: assume this year, unless that
+                // would put the entry in the future
+                if t.Year() == 0 {
+                        now := time.Now().In(timeZone)
+                        t = t.AddDate(now.Year(), 0, 0)
+                        if t.After(now) {
+                                t = t.AddDate(-1, 0, 0)
+                        }
+                }
+                return t.In(timeZone), line[len(prefix):], true
+        }
+        return time.Time{}, line, false
+}
+
+// leadingFields returns the prefix of line spanning its first n
+// whitespace-separated fields, keeping the original spacing between them.
+func leadingFields(line string, n int) string {
+        fields := 0
+        inField := false
+        for i, r := range line {
+                if r == ' ' || r == '\t' {
+                        if inField {
+                                fields++
+                                if fields == n {
+                                        return line[:i]
+                                }
+                        }
+                        inField = false
+                } else {
+                        inField = true
+                }
+        }
+        if inField && fields+1 == n {
+                return line
+        }
+        return ""
+}
+
+// Severity levels, lowest first
+const (
+        severityDebug = iota
+        severityInfo
+        severityWarn
+        severityError
+        severityFatal
+
+        severityUnknown = -1
+)
+
+// Maps the level names found in logs (and accepted by -min-level) to severities
+var severityNames = map[string]int{
+        "trace":    severityDebug,
+        "debug":    severityDebug,
+        "info":     severityInfo,
+        "notice":   severityInfo,
+        "warn":     severityWarn,
+        "warning":  severityWarn,
+        "err":      severityError,
+        "error":    severityError,
+        "crit":     severityFatal,
+        "critical": severityFatal,
+        "fatal":    severityFatal,
+        "panic":    severityFatal,
+        "alert":    severityFatal,
+        "emerg":    severityFatal,
+}
+
+var (
+        levelKeyPattern     = regexp.MustCompile(`(?i)\blevel"?\s*[=:]\s*"?([a-z]+)`)
+        bracketLevelPattern = regexp.MustCompile(`\[([A-Za-z]+)\]`)
+        syslogPriPattern    = regexp.MustCompile(`^<(\d{1,3})>`)
+        bareLevelPattern    = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERR|ERROR|CRIT|CRITICAL|FATAL|PANIC|ALERT|EMERG)\b`)
+)
+
+// lineSeverity extracts the severity of a log line from common formats:
+// level=error / "level":"error", [ERROR], a leading syslog <PRI>, or a bare
+// upper-case level word. Returns severityUnknown when none is found.
+func lineSeverity(line string) int {
+        if m := levelKeyPattern.FindStringSubmatch(line); m != nil {
+                if sev, ok := severityNames[strings.ToLower(m[1])]; ok {
+                        return sev
+                }
+        }
+        for _, m := range bracketLevelPattern.FindAllStringSubmatch(line, -1) {
+                if sev, ok := severityNames[strings.ToLower(m[1])]; ok {
+                        return sev
+                }
+        }
+        if m := syslogPriPattern.FindStringSubmatch(line); m != nil {
+                pri, _ := strconv.Atoi(m[1])
+                switch pri % 8 {
+                case 0, 1, 2: // emerg, alert, crit
+                        return severityFatal
+                case 3:
+                        return severityError
+                case 4:
+                        return severityWarn
+                case 5, 6: // notice, info
+                        return severityInfo
+                default:
+                        return severityDebug
+                }
+        }
+        if m := bareLevelPattern.FindStringSubmatch(line); m != nil {
+                return severityNames[strings.ToLower(m[1])]
+        }
+        return severityUnknown
+}
+
+// meetsMinSeverity reports whether a line passes the -min-level filter. Lines
+// without a detectable severity count as INFO unless -keep-unleveled is set.
+func meetsMinSeverity(line string, min int) bool {
+        sev := lineSeverity(line)
+        if sev == severityUnknown {
+                if cfg.KeepUnleveled {
+                        return true
+                }
+                sev = severityInfo
+        }
+        return sev >= min
+}
+
+// syslogTagPattern matches the "tag[pid]:" after the timestamp of a syslog
+// line, optionally preceded by the host name
+var syslogTagPattern = regexp.MustCompile(`^\s*(?:\S+\s+)?([^\s\[\]:]+)(?:\[(\d+)\])?:(?:\s|$)`)
+
+// parseSyslogTag extracts the program name and PID from a syslog line such as
+// "Jan  2 15:04:05 host sshd[123]: message". pid is 0 when the tag has none.
+func parseSyslogTag(line string) (tag string, pid int, ok bool) {
+        line = syslogPriPattern.ReplaceAllString(line, "")
+        _, rest, _ := splitLogTimestamp(line)
+        m := syslogTagPattern.FindStringSubmatch(rest)
+        if m == nil {
+                return "", 0, false
+        }
+        if m[2] != "" {
+                pid, _ = strconv.Atoi(m[2])
+        }
+        return m[1], pid, true
+}
+
+// compilePatterns compiles each regular expression, naming the offending
+// pattern if one is invalid.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+        var compiled []*regexp.Regexp
+        for _, p := range patterns {
+                re, err := regexp.Compile(p)
+                if err != nil {
+                        return nil, fmt.Errorf("pattern %q: %v", p, err)
+                }
+                compiled = append(compiled, re)
+        }
+        return compiled, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, line string) bool {
+        for _, re := range patterns {
+                if re.MatchString(line) {
+                        return true
+                }
+        }
+        return false
+}
+
+// logEntry is a log line that survived filtering, with its parsed timestamp
+type logEntry struct {
+        Time   time.Time
+        Text   string
+        Source string // Name of the file the line came from
+        Count  int    // Occurrences this entry stands for after -dedup
+
+        Context bool // Kept by -context-lines for a nearby entry, not on its own
+
+        // Numbers of the entry's first and last line in its source, for the
+        // chunk labels; 0 if unknown
+        Line     int
+        LastLine int
+}
+
+// lineFilter holds the per-line filters and counts what each one dropped
+type lineFilter struct {
+        Start       time.Time
+        End         time.Time
+        MinSeverity int
+        Include     []*regexp.Regexp
+        Exclude     []*regexp.Regexp
+
+        // -json-logs and -logfmt settings
+        JSONLogs bool
+        Logfmt   bool
+        TSField  string
+        Fields   []string
+
+        // -line-format, and with DropUnmatched the lines it doesn't match are
+        // dropped instead of read as plain text
+        LineFormat    *lineFormat
+        DropUnmatched bool
+
+        // -process and -pid: only lines whose syslog tag matches are kept,
+        // and with KeepUntagged lines without one too
+        Process      string
+        PID          int
+        KeepUntagged bool
+
+        // FirstLine is the number scan gives the first line it reads, 1 for a
+        // whole file. 0 leaves the entries without line numbers, for input
+        // that doesn't start at the top of a file.
+        FirstLine int
+
+        MaxLineLength int // Longer lines are cut short; 0 disables
+        LastN         int // Only the last N lines of each input, timestamps ignored; 0 disables
+
+        // Lines without a usable timestamp are sampled for the summary, and
+        // with KeepUnparsed still analyzed, undated
+        SampleSize   int
+        KeepUnparsed bool
+        Unparsed     []string
+
+        // With ContextLines, up to that many records before and after each
+        // kept one are kept too when MinSeverity would drop them, like grep -C
+        ContextLines int
+        before       []*logRecord // Recent records dropped by severity
+        afterLeft    int          // Records still to keep after the last kept one
+
+        Scanned         int // Every line read
+        NonEmpty        int // Lines read that weren't empty, as filtered
+        Skipped         int // No recognizable timestamp
+        Unframed        int // Continuation lines that don't look like trace frames, see framePattern
+        Malformed       int // Invalid JSON in -json-logs mode
+        InWindow        int
+        ProcessDropped  int // From another process, or untagged, with -process or -pid
+        SeverityDropped int
+        ContextKept     int // Kept by ContextLines despite their severity
+        PatternDropped  int
+        LongLines       int // Lines cut to MaxLineLength
+        NotLogfmt       int // Passed through as plain text in -logfmt mode
+        Sanitized       int // Lines with a byte order mark or invalid UTF-8, see sanitizeLine
+        Unmatched       int // Lines that didn't match -line-format
+}
+
+// resetCounts clears the per-filter drop counters before another pass
+func (f *lineFilter) resetCounts() {
+        f.Scanned, f.NonEmpty, f.Skipped, f.Unframed, f.Malformed, f.InWindow, f.ProcessDropped, f.SeverityDropped, f.ContextKept, f.PatternDropped, f.LongLines, f.NotLogfmt, f.Sanitized, f.Unmatched = 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0
+        f.Unparsed = nil
+}
+
+// unparsed notes a line that was skipped or malformed, keeping a uniform
+// random sample of SampleSize such lines. With KeepUnparsed the line is
+// still kept as an undated record.
+func (f *lineFilter) unparsed(entries []logEntry, line string, n int, source string) []logEntry {
+        f.sampleUnparsed(line, source)
+        if f.KeepUnparsed {
+                return f.keep(entries, &logRecord{Lines: []string{line}, Line: n}, source)
+        }
+        return entries
+}
+
+// sampleUnparsed adds a line counted in unparsedLines to the sample
+func (f *lineFilter) sampleUnparsed(line, source string) {
+        sample := source + ": " + line
+        if len(f.Unparsed) < f.SampleSize {
+                f.Unparsed = append(f.Unparsed, sample)
+        } else if i := rand.Intn(f.unparsedLines()); i < f.SampleSize {
+                f.Unparsed[i] = sample
+        }
+}
+
+// unparsedLines counts the lines without a usable timestamp: skipped,
+// malformed, or attached to the record before them without looking like
+// part of it
+func (f *lineFilter) unparsedLines() int {
+        return f.Skipped + f.Unframed + f.Malformed
+}
+
+// scan reads log lines from r and returns those that pass every filter.
+// Continuation lines such as stack trace frames stay with the entry they
+// belong to, so a multi-line entry is kept or dropped as a whole.
+// Entries read before a read error are still returned along with the error.
+// With LastN set only the last LastN lines are filtered, and lines without a
+// timestamp are kept as records of their own instead of skipped.
+func (f *lineFilter) scan(r io.Reader, source string) ([]logEntry, error) {
+        var entries []logEntry
+        // Context never reaches across files
+        f.before, f.afterLeft = nil, 0
+        lineNo := f.FirstLine - 1 // Number of the line last read
+        scanner := newLineScanner(r, func(n int) {
+                lineNo++
+                logWarnf("Skipping oversized log line in %s (%d bytes)", source, n)
+        })
+        grouper := &multilineGrouper{}
+        process := func(line string, n int) {
+                if len(line) == 0 {
+                        return
+                }
+                f.NonEmpty++
+                if f.JSONLogs {
+                        logTime, text, ok, err := parseJSONLogLine(line, f.TSField, f.Fields)
+                        if err != nil {
+                                f.Malformed++
+                                entries = f.unparsed(entries, line, n, source)
+                                return
+                        }
+                        if !ok && f.LastN == 0 {
+                                f.Skipped++
+                                entries = f.unparsed(entries, line, n, source)
+                                return
+                        }
+                        entries = f.keep(entries, &logRecord{Time: logTime, Lines: []string{text}, Line: n}, source)
+                        return
+                }
+                if f.Logfmt {
+                        logTime, text, ok, err := parseLogfmtLine(line, f.TSField, f.Fields)
+                        if err == nil {
+                                // Finish any plain text record first to keep the order
+                                if done := grouper.flush(); done != nil {
+                                        entries = f.keep(entries, done, source)
+                                }
+                                if !ok && f.LastN == 0 {
+                                        f.Skipped++
+                                        entries = f.unparsed(entries, line, n, source)
+                                        return
+                                }
+                                entries = f.keep(entries, &logRecord{Time: logTime, Lines: []string{text}, Line: n}, source)
+                                return
+                        }
+                        f.NotLogfmt++
+                }
+                if f.LineFormat != nil {
+                        logTime, text, ok, matched := f.LineFormat.parse(line)
+                        switch {
+                        case matched && !ok && f.LastN == 0:
+                                if done := grouper.flush(); done != nil {
+                                        entries = f.keep(entries, done, source)
+                                }
+                                f.Skipped++
+                                entries = f.unparsed(entries, line, n, source)
+                                return
+                        case matched:
+                                // Continuation lines that follow still belong to this record
+                                if done := grouper.start(&logRecord{Time: logTime, Lines: []string{text}, Line: n}); done != nil {
+                                        entries = f.keep(entries, done, source)
+                                }
+                                return
+                        }
+                        f.Unmatched++
+                        if f.DropUnmatched {
+                                return
+                        }
+                }
+
+                unframed := grouper.unframed
+                done, orphan := grouper.add(line, n)
+                if grouper.unframed > unframed {
+                        f.Unframed++
+                        f.sampleUnparsed(line, source)
+                }
+                if orphan {
+                        if f.LastN > 0 {
+                                entries = f.keep(entries, &logRecord{Lines: []string{line}, Line: n}, source)
+                        } else {
+                                f.Skipped++
+                                entries = f.unparsed(entries, line, n, source)
+                        }
+                }
+                if done != nil {
+                        entries = f.keep(entries, done, source)
+                }
+        }
+
+        var tail []string
+        var tailNumbers []int
+        for scanner.Scan() {
+                f.Scanned++
+                lineNo++
+                n := lineNo
+                if f.FirstLine == 0 {
+                        n = 0
+                }
+                line := scanner.Text()
+                if clean := sanitizeLine(line); clean != line {
+                        f.Sanitized++
+                        line = clean
+                }
+                if f.LastN > 0 {
+                        tail, tailNumbers = append(tail, line), append(tailNumbers, n)
+                        if len(tail) > f.LastN {
+                                tail, tailNumbers = tail[1:], tailNumbers[1:]
+                        }
+                        continue
+                }
+                process(line, n)
+        }
+        for i, line := range tail {
+                process(line, tailNumbers[i])
+        }
+        if last := grouper.flush(); last != nil {
+                entries = f.keep(entries, last, source)
+        }
+        return entries, scanner.Err()
+}
+
+// sanitizeLine strips a byte order mark, as Windows programs write at the
+// start of a file, and replaces invalid UTF-8 such as stray Latin-1 bytes with
+// U+FFFD. Otherwise the BOM hides the first line's timestamp and the bad bytes
+// end up as garbage in the JSON request.
+func sanitizeLine(line string) string {
+        line = strings.TrimPrefix(line, "\uFEFF")
+        if !utf8.ValidString(line) {
+                line = strings.ToValidUTF8(line, "\uFFFD")
+        }
+        return line
+}
+
+// keep applies the window, severity and pattern filters to a record and
+// appends it to entries if it passes. Severity comes from the record's first
+// line; the patterns see the whole record. Records dropped by severity are
+// still kept as context near a kept record with ContextLines, unless -exclude
+// matches them.
+func (f *lineFilter) keep(entries []logEntry, record *logRecord, source string) []logEntry {
+        // Both ends are inclusive so events exactly on -since/-until are kept.
+        // Undated records only get here when they are to be kept regardless.
+        if f.LastN == 0 && !record.Time.IsZero() && (record.Time.Before(f.Start) || record.Time.After(f.End)) {
+                return entries
+        }
+        f.InWindow++
+
+        if !f.matchesProcess(record.Lines[0]) {
+                f.ProcessDropped++
+                return entries
+        }
+        if !meetsMinSeverity(record.Lines[0], f.MinSeverity) {
+                if f.ContextLines > 0 && !matchesAny(f.Exclude, record.text()) {
+                        if f.afterLeft > 0 {
+                                f.afterLeft--
+                                f.ContextKept++
+                                return f.add(entries, record, source, true)
+                        }
+                        f.before = append(f.before, record)
+                        if len(f.before) > f.ContextLines {
+                                f.before = f.before[1:]
+                        }
+                }
+                f.SeverityDropped++
+                return entries
+        }
+        text := record.text()
+        if len(f.Include) > 0 && !matchesAny(f.Include, text) {
+                f.PatternDropped++
+                return entries
+        }
+        if matchesAny(f.Exclude, text) {
+                f.PatternDropped++
+                return entries
+        }
+
+        // Records held back as context go in first, in their original order
+        for _, held := range f.before {
+                entries = f.add(entries, held, source, true)
+        }
+        f.SeverityDropped -= len(f.before)
+        f.ContextKept += len(f.before)
+        f.before, f.afterLeft = nil, f.ContextLines
+        return f.add(entries, record, source, false)
+}
+
+// matchesProcess reports whether a line passes the -process and -pid
+// filters. A line whose tag has no PID counts as untagged for -pid.
+func (f *lineFilter) matchesProcess(line string) bool {
+        if f.Process == "" && f.PID == 0 {
+                return true
+        }
+        tag, pid, ok := parseSyslogTag(line)
+        if !ok || (f.PID != 0 && pid == 0) {
+                return f.KeepUntagged
+        }
+        return (f.Process == "" || tag == f.Process) && (f.PID == 0 || pid == f.PID)
+}
+
+// add appends a record that passed the filters to entries, cutting lines
+// longer than MaxLineLength
+func (f *lineFilter) add(entries []logEntry, record *logRecord, source string, context bool) []logEntry {
+        text := record.text()
+        if f.MaxLineLength > 0 {
+                cut := false
+                for i, line := range record.Lines {
+                        if short, ok := truncateLine(line, f.MaxLineLength); ok {
+                                record.Lines[i] = short
+                                f.LongLines++
+                                cut = true
+                        }
+                }
+                if cut {
+                        text = record.text()
+                }
+        }
+        return append(entries, logEntry{Time: record.Time, Text: text, Source: source, Context: context, Line: record.Line, LastLine: record.lastLine()})
+}
+
+// dropRatio is the fraction of non-empty lines that had no usable timestamp
+// or weren't valid JSON, see unparsedLines. Lines kept undated with
+// KeepUnparsed don't count.
+func (f *lineFilter) dropRatio() float64 {
+        if f.NonEmpty == 0 || f.KeepUnparsed {
+                return 0
+        }
+        return float64(f.unparsedLines()) / float64(f.NonEmpty)
+}
+
+// truncateLine cuts a line longer than max bytes, on a UTF-8 boundary, and
+// marks how much was removed
+func truncateLine(line string, max int) (string, bool) {
+        if len(line) <= max {
+                return line, false
+        }
+        cut := max
+        for cut > 0 && !utf8.RuneStart(line[cut]) {
+                cut--
+        }
+        return fmt.Sprintf("%s…[truncated %d bytes]", line[:cut], len(line)-cut), true
+}
+
+// sourceName is the label used to tag lines from the given -log path
+func sourceName(path string) string {
+        if path == "-" {
+                return "stdin"
+        }
+        if isSSHPath(path) {
+                return sshSourceName(path)
+        }
+        return filepath.Base(path)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+        "strings"
+        "testing"
+        "time"
+)
+
+// useTimeZone sets the -tz location for the test and restores it afterwards
+func useTimeZone(t *testing.T, loc *time.Location) {
+        t.Helper()
+        saved := timeZone
+        timeZone = loc
+        t.Cleanup(func() { timeZone = saved })
+}
+
+func TestKeepWindowBoundaries(t *testing.T) {
+        start := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+        end := start.Add(time.Hour)
+        tests := []struct {
+                name string
+                at   time.Time
+                want bool
+        }{
+                {"before start", start.Add(-time.Nanosecond), false},
+                {"exactly at start", start, true},
+                {"inside", start.Add(30 * time.Minute), true},
+                {"exactly at end", end, true},
+                {"after end", end.Add(time.Nanosecond), false},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        f := &lineFilter{Start: start, End: end, MinSeverity: severityDebug}
+                        record := &logRecord{Time: tt.at, Lines: []string{"INFO boundary event"}}
+                        kept := len(f.keep(nil, record, "test.log")) == 1
+                        if kept != tt.want {
+                                t.Errorf("kept = %v, want %v", kept, tt.want)
+                        }
+                })
+        }
+}
+
+func TestScanWindowBoundaries(t *testing.T) {
+        useTimeZone(t, time.UTC)
+        f := &lineFilter{
+                Start:       time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC),
+                End:         time.Date(2024, 1, 2, 16, 0, 0, 0, time.UTC),
+                MinSeverity: severityDebug,
+                FirstLine:   1,
+        }
+        input := strings.Join([]string{
+                "2024-01-02T14:59:59Z INFO one second early",
+                "2024-01-02T15:00:00Z INFO on the start",
+                "2024-01-02T16:00:00Z INFO on the end",
+                "2024-01-02T16:00:01Z INFO one second late",
+        }, "\n")
+
+        entries, err := f.scan(strings.NewReader(input), "test.log")
+        if err != nil {
+                t.Fatalf("scan: %v", err)
+        }
+        var got []string
+        for _, entry := range entries {
+                got = append(got, entry.Text[len("2024-01-02T15:00:00Z INFO "):])
+        }
+        if want := "on the start,on the end"; strings.Join(got, ",") != want {
+                t.Errorf("kept %q, want %q", strings.Join(got, ","), want)
+        }
+        if f.InWindow != 2 {
+                t.Errorf("InWindow = %d, want 2", f.InWindow)
+        }
+}
+
+func TestParseLogTimestamp(t *testing.T) {
+        useTimeZone(t, time.UTC)
+        tests := []struct {
+                name string
+                line string
+                want time.Time
+                rest string
+                ok   bool
+        }{
+                {"RFC3339 with Z", "2024-01-02T15:04:05Z msg", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), " msg", true},
+                {"+00:00 offset equals Z", "2024-01-02T15:04:05+00:00 msg", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), " msg", true},
+                {"other offset", "2024-01-02T16:04:05+01:00 msg", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), " msg", true},
+                {"-0700 offset", "2024-01-02T08:04:05-0700 msg", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), " msg", true},
+                {"milliseconds", "2024-01-02T15:04:05.123Z msg", time.Date(2024, 1, 2, 15, 4, 5, 123000000, time.UTC), " msg", true},
+                {"microseconds", "2024-01-02T15:04:05.123456Z msg", time.Date(2024, 1, 2, 15, 4, 5, 123456000, time.UTC), " msg", true},
+                {"nanoseconds", "2024-01-02T15:04:05.123456789Z msg", time.Date(2024, 1, 2, 15, 4, 5, 123456789, time.UTC), " msg", true},
+                {"nanoseconds with offset", "2024-01-02T15:04:05.000000001+00:00 msg", time.Date(2024, 1, 2, 15, 4, 5, 1, time.UTC), " msg", true},
+                {"no zone is -tz", "2024-01-02T15:04:05 msg", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), " msg", true},
+                {"space separated", "2024-01-02 15:04:05 msg", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), " msg", true},
+                {"space separated with comma fraction", "2024-01-02 15:04:05,250 msg", time.Date(2024, 1, 2, 15, 4, 5, 250000000, time.UTC), " msg", true},
+                {"space separated with offset", "2024-01-02 16:04:05+01:00 msg", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), " msg", true},
+                {"timestamp only", "2024-01-02T15:04:05Z", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), "", true},
+                {"not a timestamp", "    at com.example.Main(Main.java:10)", time.Time{}, "    at com.example.Main(Main.java:10)", false},
+                {"empty", "", time.Time{}, "", false},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        got, rest, ok := splitLogTimestamp(tt.line)
+                        if ok != tt.ok {
+                                t.Fatalf("ok = %v, want %v", ok, tt.ok)
+                        }
+                        if !got.Equal(tt.want) {
+                                t.Errorf("time = %s, want %s", got.Format(time.RFC3339Nano), tt.want.Format(time.RFC3339Nano))
+                        }
+                        if rest != tt.rest {
+                                t.Errorf("rest = %q, want %q", rest, tt.rest)
+                        }
+                        if parsed, parsedOK := parseLogTimestamp(tt.line); parsedOK != ok || !parsed.Equal(got) {
+                                t.Errorf("parseLogTimestamp = %s, %v; splitLogTimestamp = %s, %v", parsed, parsedOK, got, ok)
+                        }
+                })
+        }
+
+        t.Run("zoneless timestamps follow -tz", func(t *testing.T) {
+                berlin, err := time.LoadLocation("Europe/Berlin")
+                if err != nil {
+                        t.Skipf("no time zone data: %v", err)
+                }
+                useTimeZone(t, berlin)
+                got, ok := parseLogTimestamp("2024-01-02 16:04:05 msg")
+                if want := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC); !ok || !got.Equal(want) {
+                        t.Errorf("got %s, %v, want %s", got, ok, want)
+                }
+        })
+}
+
+func TestScanCountsUnframedContinuations(t *testing.T) {
+        useTimeZone(t, time.UTC)
+        f := &lineFilter{
+                Start:       time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC),
+                End:         time.Date(2024, 1, 2, 16, 0, 0, 0, time.UTC),
+                MinSeverity: severityDebug,
+                FirstLine:   1,
+                SampleSize:  5,
+        }
+        input := strings.Join([]string{
+                "orphan before the first timestamp",
+                "2024-01-02T15:00:00Z ERROR request failed",
+                "java.lang.IllegalStateException: boom",
+                "    at com.example.Handler.run(Handler.java:42)",
+                "Caused by: java.io.IOException: closed",
+                "... 12 more",
+                "02/Jan/2024 15:00:01 ERROR unrecognized timestamp",
+                "02/Jan/2024 15:00:02 ERROR another one",
+        }, "\n")
+
+        if _, err := f.scan(strings.NewReader(input), "test.log"); err != nil {
+                t.Fatalf("scan: %v", err)
+        }
+        if f.Skipped != 1 || f.Unframed != 2 {
+                t.Errorf("Skipped, Unframed = %d, %d, want 1, 2", f.Skipped, f.Unframed)
+        }
+        if got, want := f.dropRatio(), 3.0/8; got != want {
+                t.Errorf("dropRatio = %g, want %g", got, want)
+        }
+        if len(f.Unparsed) != 3 {
+                t.Errorf("sampled %d unparsed lines, want 3: %q", len(f.Unparsed), f.Unparsed)
+        }
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "regexp"
+        "sort"
+        "strings"
+        "sync/atomic"
+)
+
+// Finding is one issue reported by the model, as tagged in its analysis
+type Finding struct {
+        Severity  string `json:"severity"`
+        Component string `json:"component,omitempty"`
+        Message   string `json:"message"`
+}
+
+// Severities a finding can be tagged with, most severe first
+var findingSeverities = []string{"CRITICAL", "ERROR", "WARNING", "INFO"}
+
+// Asks the model to tag each finding so parseFindings can pick it up
+const findingFormatPrompt = "List each finding on its own line as \"- [SEVERITY] component: message\", " +
+        "where SEVERITY is one of CRITICAL, ERROR, WARNING or INFO."
+
+// Replaces findingFormatPrompt in the system prompt with -json-mode
+const findingJSONPrompt = `Reply with only a JSON object of the form {"findings": [{"severity": "ERROR", "component": "db", "message": "..."}]}, ` +
+        "where severity is one of CRITICAL, ERROR, WARNING or INFO and component may be left out. Use an empty array if nothing needs attention."
+
+// proseReplies counts the -json-mode replies that were not findings JSON
+var proseReplies atomic.Int64
+
+var (
+        // "- [ERROR] db: message", "1. **WARNING** message", "CRITICAL: message", ...
+        findingPattern = regexp.MustCompile(`(?i)^\s*(?:[-*•]|\d+[.)])?\s*(?:\[(critical|fatal|error|warning|warn|info)\]|\*\*\[?(critical|fatal|error|warning|warn|info)\]?\*\*|(critical|fatal|error|warning|warn|info)\s*:)\s*[:\-–]?\s*(.+)$`)
+        // Optional "component:" or "component=name:" at the start of the message
+        componentPattern = regexp.MustCompile(`^(?:component=)?([\w.\-/]+):\s+(.+)$`)
+)
+
+// parseFindings extracts the tagged findings from one analysis. Lines that
+// don't look like a finding are ignored, so an analysis the model wrote as
+// free prose yields no findings.
+func parseFindings(analysis string) []Finding {
+        var findings []Finding
+        for _, line := range strings.Split(analysis, "\n") {
+                m := findingPattern.FindStringSubmatch(line)
+                if m == nil {
+                        continue
+                }
+                severity := m[1] + m[2] + m[3] // Only one of the alternatives matched
+                finding := Finding{Severity: normalizeFindingSeverity(severity), Message: strings.TrimSpace(m[4])}
+                if c := componentPattern.FindStringSubmatch(finding.Message); c != nil {
+                        finding.Component, finding.Message = c[1], strings.TrimSpace(c[2])
+                }
+                findings = append(findings, finding)
+        }
+        return findings
+}
+
+// jsonFindings reads a -json-mode reply and renders its findings as the
+// tagged lines parseFindings picks up, so the rest of the pipeline handles them
+// like any other analysis. A reply that isn't findings JSON, because the model
+// ignored the instruction, is kept as it is and counted in proseReplies.
+func jsonFindings(reply, chunkLabel string) string {
+        text := strings.TrimSpace(reply)
+        // Some models wrap the object in a markdown code fence anyway
+        text = strings.TrimPrefix(text, "```json")
+        text = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "```"), "```"))
+
+        var parsed struct {
+                Findings []Finding `json:"findings"`
+        }
+        err := json.Unmarshal([]byte(text), &parsed)
+        if err != nil {
+                // Accept a bare array too
+                err = json.Unmarshal([]byte(text), &parsed.Findings)
+        }
+        if err != nil || parsed.Findings == nil {
+                proseReplies.Add(1)
+                logWarnf("Reply for %s is not findings JSON, keeping it as prose", chunkLabel)
+                return reply
+        }
+        if len(parsed.Findings) == 0 {
+                return "No significant issues found."
+        }
+
+        var b strings.Builder
+        for _, f := range parsed.Findings {
+                severity := normalizeFindingSeverity(strings.TrimSpace(f.Severity))
+                if severity == "" {
+                        severity = "INFO"
+                }
+                fmt.Fprintf(&b, "- [%s] ", severity)
+                if component := strings.TrimSpace(f.Component); component != "" {
+                        b.WriteString(component + ": ")
+                }
+                b.WriteString(strings.Join(strings.Fields(f.Message), " ") + "\n")
+        }
+        return strings.TrimSuffix(b.String(), "\n")
+}
+
+func normalizeFindingSeverity(s string) string {
+        switch s = strings.ToUpper(s); s {
+        case "FATAL":
+                return "CRITICAL"
+        case "WARN":
+                return "WARNING"
+        }
+        return s
+}
+
+// countFindings tallies findings per severity across all analyses. unparsed
+// is the number of analyses no finding could be read from; they count as
+// zero findings.
+func countFindings(analyses []string) (map[string]int, int) {
+        counts := map[string]int{}
+        for _, severity := range findingSeverities {
+                counts[severity] = 0
+        }
+        unparsed := 0
+        for _, analysis := range analyses {
+                findings := parseFindings(analysis)
+                if len(findings) == 0 {
+                        unparsed++
+                        continue
+                }
+                for _, f := range findings {
+                        counts[f.Severity]++
+                }
+        }
+        return counts, unparsed
+}
+
+// Section for findings without a component under -group-by component
+const uncategorized = "Uncategorized"
+
+// componentGroup is everything reported about one component
+type componentGroup struct {
+        Component string
+        Findings  []chunkFinding
+        Unparsed  []string // Only in Uncategorized: analyses with no tagged findings
+}
+
+// chunkFinding is a finding along with the label of the chunk it came from
+type chunkFinding struct {
+        Finding
+        Chunk string
+}
+
+// groupFindingsByComponent regroups the analyses' findings per component,
+// most severe first within each. Components are sorted by name, with
+// Uncategorized last; it also collects analyses no finding could be read
+// from, so nothing is lost.
+func groupFindingsByComponent(analyses []string) []componentGroup {
+        groups := map[string]*componentGroup{}
+        group := func(name string) *componentGroup {
+                if groups[name] == nil {
+                        groups[name] = &componentGroup{Component: name}
+                }
+                return groups[name]
+        }
+        for _, analysis := range analyses {
+                label, body := splitAnalysisHeader(analysis)
+                findings := parseFindings(body)
+                if len(findings) == 0 {
+                        g := group(uncategorized)
+                        g.Unparsed = append(g.Unparsed, analysis)
+                        continue
+                }
+                for _, f := range findings {
+                        name := f.Component
+                        if name == "" {
+                                name = uncategorized
+                        }
+                        g := group(name)
+                        g.Findings = append(g.Findings, chunkFinding{Finding: f, Chunk: label})
+                }
+        }
+
+        var out []componentGroup
+        for _, g := range groups {
+                sort.SliceStable(g.Findings, func(i, j int) bool {
+                        return severityRank(g.Findings[i].Severity) < severityRank(g.Findings[j].Severity)
+                })
+                out = append(out, *g)
+        }
+        sort.Slice(out, func(i, j int) bool {
+                if (out[i].Component == uncategorized) != (out[j].Component == uncategorized) {
+                        return out[j].Component == uncategorized
+                }
+                return out[i].Component < out[j].Component
+        })
+        return out
+}
+
+// analysesByPriority returns the indexes of the analyses, those mentioning
+// the earliest of keywords first. Analyses are compared by their most
+// important keyword, then by how often it occurs; ties keep chunk order.
+func analysesByPriority(analyses []string, keywords []string) []int {
+        type score struct{ rank, count int }
+        scores := make([]score, len(analyses))
+        for i, analysis := range analyses {
+                upper := strings.ToUpper(analysis)
+                scores[i] = score{rank: len(keywords)}
+                for rank, keyword := range keywords {
+                        if n := strings.Count(upper, strings.ToUpper(keyword)); n > 0 {
+                                scores[i] = score{rank, n}
+                                break
+                        }
+                }
+        }
+
+        order := make([]int, len(analyses))
+        for i := range order {
+                order[i] = i
+        }
+        sort.SliceStable(order, func(a, b int) bool {
+                sa, sb := scores[order[a]], scores[order[b]]
+                if sa.rank != sb.rank {
+                        return sa.rank < sb.rank
+                }
+                return sa.count > sb.count
+        })
+        return order
+}
+
+// severityRank orders severities as in findingSeverities
+func severityRank(severity string) int {
+        for i, s := range findingSeverities {
+                if s == severity {
+                        return i
+                }
+        }
+        return len(findingSeverities)
+}
+
+// splitAnalysisHeader separates the chunk label added by analysisHeader from
+// the analysis text
+func splitAnalysisHeader(analysis string) (string, string) {
+        if strings.HasPrefix(analysis, "=== ") {
+                if end := strings.Index(analysis, " ===\n\n"); end > 0 {
+                        return analysis[4:end], analysis[end+len(" ===\n\n"):]
+                }
+        }
+        return "", analysis
+}
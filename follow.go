@@ -0,0 +1,182 @@
+package main
+
+import (
+        "io"
+        "os"
+        "strings"
+        "time"
+)
+
+// logFollower picks up the lines appended to a log file since the last poll,
+// reopening the file when it is rotated.
+type logFollower struct {
+        path    string
+        source  string
+        file    *os.File
+        info    os.FileInfo
+        offset  int64
+        partial string   // Trailing line still being written
+        held    []string // Last record, whose continuation lines may still follow
+}
+
+// newLogFollower starts following path where the first pass stopped reading
+// it, so lines written while that pass was analyzed aren't missed. A file
+// rotated since is followed from its top, and one the first pass didn't read
+// from its current end.
+func newLogFollower(path string) (*logFollower, error) {
+        file, err := os.Open(path)
+        if err != nil {
+                return nil, err
+        }
+        info, err := file.Stat()
+        if err != nil {
+                file.Close()
+                return nil, err
+        }
+        offset := info.Size()
+        if read, ok := openedLogs[path]; ok {
+                if os.SameFile(read, info) && logOffsets[path] <= info.Size() {
+                        offset = logOffsets[path]
+                } else {
+                        logInfof("Log file %s was rotated since it was read, following the new file from the top", path)
+                        offset = 0
+                }
+        }
+        return &logFollower{path: path, source: sourceName(path), file: file, info: info, offset: offset}, nil
+}
+
+// poll returns the complete lines written since the previous call. The last
+// record is held back until the next poll, so a stack trace written across
+// two polls isn't split from its header; once a poll finds nothing new it is
+// complete and returned.
+func (f *logFollower) poll() ([]string, error) {
+        lines, err := f.read()
+        if err != nil {
+                return nil, err
+        }
+        lines = append(f.held, lines...)
+        if len(lines) == len(f.held) {
+                f.held = nil
+                return lines, nil
+        }
+        cut := len(lines)
+        for i := len(lines) - 1; i >= 0; i-- {
+                if _, ok := parseLogTimestamp(lines[i]); ok {
+                        cut = i
+                        break
+                }
+        }
+        f.held = lines[cut:]
+        return lines[:cut], nil
+}
+
+// read returns the complete lines appended since the previous call
+func (f *logFollower) read() ([]string, error) {
+        info, err := os.Stat(f.path)
+        if err != nil {
+                // Mid-rotation the path can be briefly missing; try again next cycle
+                return nil, nil
+        }
+
+        // A new inode or a shrunken file means the log was rotated or truncated
+        if !os.SameFile(info, f.info) || info.Size() < f.offset {
+                logInfof("Log file %s was rotated, reopening", f.path)
+                file, err := os.Open(f.path)
+                if err != nil {
+                        return nil, err
+                }
+                f.file.Close()
+                f.file, f.offset, f.partial = file, 0, ""
+                if info, err = file.Stat(); err != nil {
+                        return nil, err
+                }
+                f.info = info
+        }
+        if info.Size() == f.offset {
+                return nil, nil
+        }
+
+        data, err := io.ReadAll(io.NewSectionReader(f.file, f.offset, info.Size()-f.offset))
+        if err != nil {
+                return nil, err
+        }
+        f.offset += int64(len(data))
+
+        lines := strings.Split(f.partial+string(data), "\n")
+        f.partial = lines[len(lines)-1]
+        return lines[:len(lines)-1], nil
+}
+
+func (f *logFollower) Close() error {
+        return f.file.Close()
+}
+
+// followLogs implements -follow: every -interval it reads the lines appended
+// to the logs, drops entries that have aged out of -window and analyzes what
+// is left, until a shutdown signal arrives.
+func followLogs(entries []logEntry, filter *lineFilter, tokenizer Tokenizer) int {
+        var followers []*logFollower
+        for _, path := range cfg.LogPaths {
+                follower, err := newLogFollower(path)
+                if err != nil {
+                        logWarnf("Not following %s: %v", path, err)
+                        continue
+                }
+                defer follower.Close()
+                followers = append(followers, follower)
+        }
+        if len(followers) == 0 {
+                logFatalf("-follow: none of the log files can be followed")
+        }
+
+        logInfof("Following %d log files, analyzing the last %s every %s", len(followers), cfg.Window, cfg.Interval)
+        for {
+                select {
+                case <-time.After(cfg.Interval):
+                case <-stopDispatch:
+                        return exitInterrupted
+                }
+
+                var lines int
+                var fresh []logEntry
+                now := time.Now().In(timeZone)
+                cycle := *filter
+                cycle.resetCounts()
+                cycle.Start, cycle.End = now.Add(-cfg.Window), now
+                // Only the appended lines are read, so their numbers aren't known
+                cycle.FirstLine = 0
+                for _, follower := range followers {
+                        newLines, err := follower.poll()
+                        if err != nil {
+                                logWarnf("Failed to read %s: %v", follower.path, err)
+                                continue
+                        }
+                        lines += len(newLines)
+                        // scan applies the same filters as the initial pass
+                        newEntries, err := cycle.scan(strings.NewReader(strings.Join(newLines, "\n")), follower.source)
+                        if err != nil {
+                                logWarnf("Stopped reading %s early: %v", follower.path, err)
+                        }
+                        fresh = append(fresh, newEntries...)
+                }
+
+                var kept []logEntry
+                for _, entry := range entries {
+                        if !entry.Time.Before(cycle.Start) {
+                                kept = append(kept, entry)
+                        }
+                }
+                if len(fresh) == 0 && len(kept) == len(entries) {
+                        logInfof("Follow cycle: %d new lines, nothing new to analyze", lines)
+                        continue
+                }
+                entries = append(kept, fresh...)
+
+                logInfof("Follow cycle: %d new lines, %d entries in the last %s", lines, len(entries), cfg.Window)
+                code := analyzeEntries(entries, &cycle, tokenizer, now, nil)
+                saveRedactionMap()
+                if code == exitInterrupted {
+                        return code
+                }
+        }
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+        "io"
+        "os"
+        "path/filepath"
+        "reflect"
+        "testing"
+)
+
+// writeLog replaces the file at path with text
+func writeLog(t *testing.T, path, text string) {
+        t.Helper()
+        if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+                t.Fatal(err)
+        }
+}
+
+// appendLog adds text to the end of the file at path
+func appendLog(t *testing.T, path, text string) {
+        t.Helper()
+        file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+        if err != nil {
+                t.Fatal(err)
+        }
+        defer file.Close()
+        if _, err := file.WriteString(text); err != nil {
+                t.Fatal(err)
+        }
+}
+
+func TestLogFollowerStartsWhereTheFirstPassStopped(t *testing.T) {
+        useLogState(t)
+
+        path := filepath.Join(t.TempDir(), "app.log")
+        writeLog(t, path, "2024-01-02T15:00:00Z INFO first\n2024-01-02T15:00:01Z INFO partial")
+        // The first pass reads the file up to the last complete line
+        reader, err := openStatefulLog(path)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if _, err := io.ReadAll(reader); err != nil {
+                t.Fatal(err)
+        }
+        reader.Close()
+
+        // Written while the first pass was being analyzed
+        appendLog(t, path, " line\n2024-01-02T15:00:02Z INFO during analysis\n")
+        follower, err := newLogFollower(path)
+        if err != nil {
+                t.Fatal(err)
+        }
+        defer follower.Close()
+        // The last record is held back until a poll finds nothing new
+        polls := [][]string{
+                {"2024-01-02T15:00:01Z INFO partial line"},
+                {"2024-01-02T15:00:02Z INFO during analysis"},
+        }
+        for i, want := range polls {
+                lines, err := follower.poll()
+                if err != nil {
+                        t.Fatal(err)
+                }
+                if !reflect.DeepEqual(lines, want) {
+                        t.Errorf("poll %d = %q, want %q", i+1, lines, want)
+                }
+        }
+}
+
+func TestLogFollowerKeepsTracesAcrossPolls(t *testing.T) {
+        savedOpened := openedLogs
+        t.Cleanup(func() { openedLogs = savedOpened })
+        openedLogs = nil
+
+        path := filepath.Join(t.TempDir(), "app.log")
+        writeLog(t, path, "")
+        follower, err := newLogFollower(path)
+        if err != nil {
+                t.Fatal(err)
+        }
+        defer follower.Close()
+
+        writes := []string{
+                "2024-01-02T15:00:00Z INFO ok\n2024-01-02T15:00:01Z ERROR boom\n",
+                "java.lang.IllegalStateException: boom\n    at Foo.bar(Foo.java:1)\n",
+                "2024-01-02T15:00:02Z INFO next\n",
+                "",
+        }
+        want := [][]string{
+                {"2024-01-02T15:00:00Z INFO ok"},
+                nil,
+                {"2024-01-02T15:00:01Z ERROR boom", "java.lang.IllegalStateException: boom", "    at Foo.bar(Foo.java:1)"},
+                {"2024-01-02T15:00:02Z INFO next"},
+        }
+        for i, text := range writes {
+                appendLog(t, path, text)
+                lines, err := follower.poll()
+                if err != nil {
+                        t.Fatal(err)
+                }
+                if len(lines) != 0 || len(want[i]) != 0 {
+                        if !reflect.DeepEqual(lines, want[i]) {
+                                t.Errorf("poll %d = %q, want %q", i+1, lines, want[i])
+                        }
+                }
+        }
+}
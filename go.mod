@@ -0,0 +1,3 @@
+module github.com/pskalick/log-analyzer
+
+go 1.22
@@ -0,0 +1,83 @@
+package main
+
+import (
+        "strings"
+        "time"
+)
+
+// Most buckets the volume histogram shows; larger windows get wider buckets
+const maxHistogramBuckets = 48
+
+// Width of the longest histogram bar, in characters
+const histogramWidth = 40
+
+// logVolume is the number of filtered lines per -bucket across the window
+type logVolume struct {
+        Start  time.Time     `json:"start"`
+        Bucket time.Duration `json:"-"`
+        Counts []int         `json:"counts"`
+
+        BucketSeconds float64 `json:"bucket_seconds"`
+}
+
+// histogramRow is one line of the rendered histogram
+type histogramRow struct {
+        Label string
+        Bar   string
+        Count int
+}
+
+// bucketCounts counts entries per bucket from start to end. The bucket is
+// widened, in whole multiples, when the window would need more than
+// maxHistogramBuckets.
+func bucketCounts(entries []logEntry, start, end time.Time, bucket time.Duration) logVolume {
+        window := end.Sub(start)
+        if n := int64(window/bucket) + 1; n > maxHistogramBuckets {
+                bucket *= time.Duration((n + maxHistogramBuckets - 1) / maxHistogramBuckets)
+        }
+        n := int(window/bucket) + 1
+        if window%bucket == 0 && n > 1 {
+                n-- // end falls on a bucket boundary; keep it in the last bucket
+        }
+
+        volume := logVolume{Start: start, Bucket: bucket, Counts: make([]int, n), BucketSeconds: bucket.Seconds()}
+        for _, entry := range entries {
+                i := int(entry.Time.Sub(start) / bucket)
+                if i < 0 || entry.Time.After(end) {
+                        continue
+                }
+                if i >= n {
+                        i = n - 1
+                }
+                volume.Counts[i]++
+        }
+        return volume
+}
+
+// rows renders the counts as ASCII bars scaled to the busiest bucket
+func (v logVolume) rows() []histogramRow {
+        busiest := 0
+        for _, count := range v.Counts {
+                if count > busiest {
+                        busiest = count
+                }
+        }
+        layout := "15:04"
+        if v.Bucket*time.Duration(len(v.Counts)) > 24*time.Hour {
+                layout = "2006-01-02 15:04"
+        }
+
+        rows := make([]histogramRow, len(v.Counts))
+        for i, count := range v.Counts {
+                width := 0
+                if busiest > 0 {
+                        width = (count*histogramWidth + busiest - 1) / busiest
+                }
+                rows[i] = histogramRow{
+                        Label: v.Start.Add(time.Duration(i) * v.Bucket).Format(layout),
+                        Bar:   strings.Repeat("#", width),
+                        Count: count,
+                }
+        }
+        return rows
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+        "bufio"
+        "bytes"
+        "compress/gzip"
+        "fmt"
+        "io"
+        "os"
+        "strings"
+)
+
+// openLogInput opens the log file, or stdin when path is "-". Gzip-compressed
+// input (a .gz name or the gzip magic bytes) is decompressed transparently.
+func openLogInput(path string) (io.ReadCloser, error) {
+        var f io.ReadCloser = io.NopCloser(os.Stdin)
+        if path != "-" {
+                file, err := os.Open(path)
+                if err != nil {
+                        return nil, err
+                }
+                f = file
+        }
+        return decompressInput(path, f)
+}
+
+// decompressInput wraps f in a gzip reader when the data or the name says it
+// is compressed
+func decompressInput(path string, f io.ReadCloser) (io.ReadCloser, error) {
+        br := bufio.NewReader(f)
+        magic, _ := br.Peek(2)
+        isGzip := len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+        if !isGzip && !strings.HasSuffix(path, ".gz") {
+                return readCloser{br, f}, nil
+        }
+
+        zr, err := gzip.NewReader(br)
+        if err != nil {
+                // A source command that failed explains the missing data better
+                if closeErr := f.Close(); closeErr != nil {
+                        return nil, closeErr
+                }
+                return nil, fmt.Errorf("corrupt gzip header: %v", err)
+        }
+        return readCloser{gzipErrorReader{zr}, f}, nil
+}
+
+// readCloser pairs a (possibly wrapping) reader with the file it reads from
+type readCloser struct {
+        io.Reader
+        io.Closer
+}
+
+// gzipErrorReader labels decompression failures so a truncated rotated file
+// is reported as such rather than as a bare "unexpected EOF".
+type gzipErrorReader struct {
+        zr *gzip.Reader
+}
+
+func (r gzipErrorReader) Read(p []byte) (int, error) {
+        n, err := r.zr.Read(p)
+        if err != nil && err != io.EOF {
+                err = fmt.Errorf("corrupt or truncated gzip data: %w", err)
+        }
+        return n, err
+}
+
+// newLineScanner returns a scanner over r that yields one log line per token.
+// Lines longer than maxLineSize are reported to onSkip and skipped instead of
+// failing the whole scan with bufio.ErrTooLong.
+func newLineScanner(r io.Reader, onSkip func(n int)) *bufio.Scanner {
+        splitter := &longLineSplitter{max: maxLineSize, onSkip: onSkip}
+        scanner := bufio.NewScanner(r)
+        scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+        scanner.Split(splitter.split)
+        return scanner
+}
+
+// longLineSplitter is a bufio.SplitFunc that behaves like bufio.ScanLines but
+// discards any line that does not fit in the scanner's buffer.
+type longLineSplitter struct {
+        max      int
+        onSkip   func(n int)
+        skipping bool // Inside an oversized line, discarding up to the next newline
+        skipped  int
+}
+
+func (s *longLineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+        if s.skipping {
+                if i := bytes.IndexByte(data, '\n'); i >= 0 {
+                        s.finishSkip(i)
+                        return i + 1, nil, nil
+                }
+                if atEOF {
+                        s.finishSkip(len(data))
+                        return len(data), nil, nil
+                }
+                s.skipped += len(data)
+                return len(data), nil, nil
+        }
+
+        advance, token, err := bufio.ScanLines(data, atEOF)
+        if err == nil && advance == 0 && len(data) >= s.max {
+                // The buffer is full and still holds no newline
+                s.skipping = true
+                s.skipped = len(data)
+                return len(data), nil, nil
+        }
+        return advance, token, err
+}
+
+func (s *longLineSplitter) finishSkip(n int) {
+        s.skipped += n
+        if s.onSkip != nil {
+                s.onSkip(s.skipped)
+        }
+        s.skipping = false
+        s.skipped = 0
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+        "bufio"
+        "fmt"
+        "os"
+        "strings"
+)
+
+// System prompt for -interactive; the analyses of the run follow it
+const interactivePrompt = "You are a log analysis assistant. Answer the user's questions about the logs using the analysis below, " +
+        "quoting times and components where you can. Say so when the analysis doesn't cover something.\n\n"
+
+// System prompt for condensing the older part of an -interactive conversation
+const historyPrompt = "Summarize this conversation about a set of logs in a few sentences. " +
+        "Keep the facts, times, components and conclusions; drop the wording."
+
+// runInteractive is -interactive: after the summary is written it answers
+// questions typed on stdin about the analyses, keeping the conversation so
+// follow-up questions work. Once the conversation outgrows -chunk-tokens its
+// older turns are summarized. exit or end of input leaves, and the questions
+// and answers are appended to the summary file.
+func runInteractive(analyses []string, tokenizer Tokenizer) {
+        system := interactivePrompt + condenseAnalyses(analyses, tokenizer)
+        var history []chatMessage
+        var earlier string // Summary of the turns dropped from history
+        var transcript strings.Builder
+
+        fmt.Fprintln(os.Stderr, "Ask about the logs; type exit or press Ctrl-D to finish.")
+        input := bufio.NewScanner(os.Stdin)
+        for !interrupted() {
+                fmt.Fprint(os.Stderr, "> ")
+                if !input.Scan() {
+                        fmt.Fprintln(os.Stderr)
+                        break
+                }
+                question := strings.TrimSpace(input.Text())
+                if question == "" {
+                        continue
+                }
+                if question == "exit" || question == "quit" {
+                        break
+                }
+
+                history = append(history, chatMessage{Role: "user", Content: question})
+                history, earlier = condenseHistory(system, history, earlier, tokenizer)
+                prompt := system
+                if earlier != "" {
+                        prompt += "\n\nThe conversation so far, summarized:\n" + earlier
+                }
+                answer, _, err := requestConversation(prompt, history, "Question", 0)
+                if err != nil {
+                        logErrorf("Failed to answer: %v", err)
+                        history = history[:len(history)-1]
+                        continue
+                }
+                history = append(history, chatMessage{Role: "assistant", Content: answer})
+                fmt.Println(answer)
+                fmt.Fprintf(&transcript, "Q: %s\n\n%s\n\n", question, strings.TrimSpace(answer))
+        }
+
+        if transcript.Len() > 0 {
+                writeTranscript(transcript.String())
+        }
+}
+
+// condenseHistory keeps the conversation within -chunk-tokens by folding all
+// but the last exchange and the new question into earlier, the running
+// summary. If the summary can't be written the old turns are just dropped.
+func condenseHistory(system string, history []chatMessage, earlier string, tokenizer Tokenizer) ([]chatMessage, string) {
+        const keep = 3 // The last question and answer, and the new question
+        text := system + earlier
+        for _, turn := range history {
+                text += turn.Content
+        }
+        if len(history) <= keep || tokenizer.Estimate(text) <= cfg.ChunkTokens {
+                return history, earlier
+        }
+
+        old := history[:len(history)-keep]
+        var b strings.Builder
+        if earlier != "" {
+                fmt.Fprintf(&b, "Earlier: %s\n\n", earlier)
+        }
+        for _, turn := range old {
+                fmt.Fprintf(&b, "%s: %s\n\n", turn.Role, turn.Content)
+        }
+        summary, _, err := requestAnalysis(historyPrompt, b.String(), "Conversation summary", 0)
+        if err != nil {
+                logWarnf("Could not summarize the earlier conversation, dropping %d turns: %v", len(old), err)
+                summary = earlier
+        } else {
+                logDebugf("Summarized %d earlier turns of the conversation", len(old))
+        }
+        return history[len(history)-keep:], summary
+}
+
+// writeTranscript appends the -interactive questions and answers to the
+// summary file
+func writeTranscript(transcript string) {
+        if cfg.OutputPath == "" {
+                return
+        }
+        err := appendOutput(cfg.OutputPath, []byte("\n## FOLLOW-UP QUESTIONS\n\n"+transcript))
+        if err != nil {
+                logErrorf("Failed to save the questions: %v", err)
+                return
+        }
+        logInfof("Questions and answers appended to %s", cfg.OutputPath)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+        "fmt"
+        "io"
+        "os/exec"
+        "strings"
+        "time"
+)
+
+// openJournal runs journalctl for the window, optionally limited to units, and
+// returns its output. The bounds are passed to journalctl so it only reads the
+// part of the journal we need. short-iso lines start with an ISO 8601
+// timestamp the regular timestamp parser understands.
+func openJournal(start, end time.Time, units []string) (io.ReadCloser, error) {
+        path, err := exec.LookPath("journalctl")
+        if err != nil {
+                return nil, fmt.Errorf("journalctl not found in PATH; -journal needs systemd's journalctl")
+        }
+
+        args := []string{
+                "--no-pager", "--quiet", "-o", "short-iso",
+                fmt.Sprintf("--since=@%d", start.Unix()),
+                fmt.Sprintf("--until=@%d", end.Unix()),
+        }
+        for _, unit := range units {
+                args = append(args, "-u", unit)
+        }
+        journal, err := startCommand(exec.Command(path, args...), "journalctl")
+        if err != nil {
+                return nil, err
+        }
+        return journal, nil
+}
+
+// journalSource names the journal input in chunk labels
+func journalSource(units []string) string {
+        if len(units) == 0 {
+                return "journal"
+        }
+        return "journal:" + strings.Join(units, ",")
+}
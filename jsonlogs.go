@@ -0,0 +1,92 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "sort"
+        "strconv"
+        "strings"
+        "time"
+)
+
+// parseJSONLogLine reads one -json-logs line. It returns the entry's time and
+// a compact "timestamp key=value ..." rendering of the selected fields, which
+// is what the rest of the pipeline sees in place of the raw object. All
+// fields except the timestamp are kept when fields is empty. hasTime is false
+// when the object has no usable timestamp; err is set for malformed JSON.
+func parseJSONLogLine(line, tsField string, fields []string) (time.Time, string, bool, error) {
+        var obj map[string]interface{}
+        if err := json.Unmarshal([]byte(line), &obj); err != nil {
+                return time.Time{}, "", false, err
+        }
+
+        t, ok := jsonTimestamp(obj[tsField])
+        if !ok {
+                return time.Time{}, "", false, nil
+        }
+        t = t.In(timeZone)
+
+        keys := fields
+        if len(keys) == 0 {
+                for key := range obj {
+                        if key != tsField {
+                                keys = append(keys, key)
+                        }
+                }
+                sort.Strings(keys)
+        }
+
+        var b strings.Builder
+        b.WriteString(t.Format(time.RFC3339Nano))
+        for _, key := range keys {
+                value, present := obj[key]
+                if !present {
+                        continue
+                }
+                b.WriteString(" ")
+                b.WriteString(key)
+                b.WriteString("=")
+                b.WriteString(jsonFieldText(value))
+        }
+        return t, b.String(), true, nil
+}
+
+// jsonTimestamp accepts timestamp strings in any of the known layouts, and
+// numbers as Unix seconds or milliseconds.
+func jsonTimestamp(value interface{}) (time.Time, bool) {
+        switch v := value.(type) {
+        case string:
+                if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+                        return t, true
+                }
+                t, rest, ok := splitLogTimestamp(v)
+                return t, ok && strings.TrimSpace(rest) == ""
+        case float64:
+                // Anything this large can't be seconds from a sane date
+                if v > 1e12 {
+                        return time.UnixMilli(int64(v)), true
+                }
+                sec := int64(v)
+                return time.Unix(sec, int64((v-float64(sec))*1e9)), true
+        }
+        return time.Time{}, false
+}
+
+// jsonFieldText renders a field value for the model, quoting strings only
+// when they contain spaces so key=value pairs stay unambiguous.
+func jsonFieldText(value interface{}) string {
+        switch v := value.(type) {
+        case string:
+                if strings.ContainsAny(v, " \t\"=") {
+                        return strconv.Quote(v)
+                }
+                return v
+        case nil:
+                return "null"
+        case float64, bool:
+                return fmt.Sprint(v)
+        default:
+                data, _ := json.Marshal(v)
+                return string(data)
+        }
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+        "fmt"
+        "regexp"
+        "strconv"
+        "strings"
+        "time"
+)
+
+// lineFormat is a compiled -line-format: a regular expression whose named
+// groups pick the timestamp, level, component and message out of each line,
+// whatever order the log writes them in.
+type lineFormat struct {
+        pattern *regexp.Regexp
+
+        // Submatch indexes of the groups; -1 for the optional ones left out
+        ts, level, component, msg int
+}
+
+// newLineFormat compiles a -line-format. The ts and msg groups are required;
+// level and component are optional and no other names are accepted, so a
+// typo doesn't silently leave a field out.
+func newLineFormat(expr string) (*lineFormat, error) {
+        pattern, err := regexp.Compile(expr)
+        if err != nil {
+                return nil, err
+        }
+        format := &lineFormat{pattern: pattern, ts: -1, level: -1, component: -1, msg: -1}
+        for i, name := range pattern.SubexpNames() {
+                switch name {
+                case "":
+                case "ts":
+                        format.ts = i
+                case "level":
+                        format.level = i
+                case "component":
+                        format.component = i
+                case "msg":
+                        format.msg = i
+                default:
+                        return nil, fmt.Errorf("unknown group %q (want ts, level, component or msg)", name)
+                }
+        }
+        if format.ts < 0 || format.msg < 0 {
+                return nil, fmt.Errorf("needs (?P<ts>...) and (?P<msg>...) groups")
+        }
+        return format, nil
+}
+
+// parse matches a line against the format. Like parseLogfmtLine it returns
+// the entry's time and a rendering for the rest of the pipeline, here in the
+// layout it expects: "timestamp level=LEVEL component: message". matched is
+// false when the line doesn't fit the format; hasTime is false when it does
+// but the ts group holds no usable timestamp.
+func (lf *lineFormat) parse(line string) (t time.Time, text string, hasTime, matched bool) {
+        m := lf.pattern.FindStringSubmatch(line)
+        if m == nil {
+                return time.Time{}, "", false, false
+        }
+
+        ts := strings.TrimSpace(m[lf.ts])
+        if parsed, ok := jsonTimestamp(ts); ok {
+                t = parsed.In(timeZone)
+        } else if unix, err := strconv.ParseFloat(ts, 64); err == nil {
+                t, _ = jsonTimestamp(unix)
+                t = t.In(timeZone)
+        } else {
+                return time.Time{}, "", false, true
+        }
+
+        var b strings.Builder
+        b.WriteString(t.Format(time.RFC3339Nano))
+        if lf.level >= 0 && m[lf.level] != "" {
+                // lineSeverity takes the first level= it finds, so one in the message can't override this
+                b.WriteString(" level=" + m[lf.level])
+        }
+        if lf.component >= 0 && m[lf.component] != "" {
+                b.WriteString(" " + m[lf.component] + ":")
+        }
+        b.WriteString(" " + strings.TrimSpace(m[lf.msg]))
+        return t, b.String(), true, true
+}
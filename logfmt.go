@@ -0,0 +1,139 @@
+package main
+
+import (
+        "fmt"
+        "strconv"
+        "strings"
+        "time"
+)
+
+// logfmtPair is one key=value of a logfmt line
+type logfmtPair struct {
+        Key   string
+        Value string
+}
+
+// parseLogfmtLine reads one -logfmt line. Like parseJSONLogLine it returns the
+// entry's time and a compact rendering of the selected fields, all of them in
+// their original order when fields is empty. The timestamp comes from tsField,
+// or failing that the ts or time key; hasTime is false when none parses. err
+// is set when the line isn't logfmt, i.e. not entirely key=value pairs.
+func parseLogfmtLine(line, tsField string, fields []string) (time.Time, string, bool, error) {
+        pairs, err := splitLogfmt(line)
+        if err != nil {
+                return time.Time{}, "", false, err
+        }
+        values := make(map[string]string, len(pairs))
+        for _, p := range pairs {
+                values[p.Key] = p.Value
+        }
+
+        var t time.Time
+        var timeKey string
+        for _, key := range []string{tsField, "ts", "time"} {
+                value, present := values[key]
+                if !present {
+                        continue
+                }
+                if parsed, ok := jsonTimestamp(value); ok {
+                        t, timeKey = parsed.In(timeZone), key
+                        break
+                }
+                if unix, err := strconv.ParseFloat(value, 64); err == nil {
+                        t, _ = jsonTimestamp(unix)
+                        t, timeKey = t.In(timeZone), key
+                        break
+                }
+        }
+        if timeKey == "" {
+                return time.Time{}, "", false, nil
+        }
+
+        keys := fields
+        if len(keys) == 0 {
+                for _, p := range pairs {
+                        if p.Key != timeKey {
+                                keys = append(keys, p.Key)
+                        }
+                }
+        }
+
+        var b strings.Builder
+        b.WriteString(t.Format(time.RFC3339Nano))
+        for _, key := range keys {
+                value, present := values[key]
+                if !present {
+                        continue
+                }
+                b.WriteString(" ")
+                b.WriteString(key)
+                if value != "" {
+                        b.WriteString("=")
+                        b.WriteString(jsonFieldText(value))
+                }
+        }
+        return t, b.String(), true, nil
+}
+
+// splitLogfmt splits a line into its key=value pairs. Values may be quoted,
+// with Go-style escapes, to contain spaces. A bare key, as in "retry", has an
+// empty value, but a line needs at least one key=value to count as logfmt so
+// plain text isn't taken for a list of bare keys.
+func splitLogfmt(line string) ([]logfmtPair, error) {
+        var pairs []logfmtPair
+        withValue := false
+        i := 0
+        for {
+                for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+                        i++
+                }
+                if i == len(line) {
+                        break
+                }
+
+                start := i
+                for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' && line[i] != '"' {
+                        i++
+                }
+                if i == start || (i < len(line) && line[i] == '"') {
+                        return nil, fmt.Errorf("expected key=value at offset %d", start)
+                }
+                key := line[start:i]
+                if i == len(line) || line[i] != '=' {
+                        pairs = append(pairs, logfmtPair{Key: key})
+                        continue
+                }
+                i++ // the '='
+                withValue = true
+
+                var value string
+                if i < len(line) && line[i] == '"' {
+                        end := i + 1
+                        for end < len(line) && line[end] != '"' {
+                                if line[end] == '\\' {
+                                        end++
+                                }
+                                end++
+                        }
+                        if end >= len(line) {
+                                return nil, fmt.Errorf("unterminated quoted value for %s", key)
+                        }
+                        unquoted, err := strconv.Unquote(line[i : end+1])
+                        if err != nil {
+                                return nil, fmt.Errorf("invalid quoted value for %s: %v", key, err)
+                        }
+                        value, i = unquoted, end+1
+                } else {
+                        start = i
+                        for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+                                i++
+                        }
+                        value = line[start:i]
+                }
+                pairs = append(pairs, logfmtPair{Key: key, Value: value})
+        }
+        if !withValue {
+                return nil, fmt.Errorf("no key=value pairs")
+        }
+        return pairs, nil
+}
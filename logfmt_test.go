@@ -0,0 +1,116 @@
+package main
+
+import (
+        "reflect"
+        "testing"
+        "time"
+)
+
+func TestSplitLogfmt(t *testing.T) {
+        tests := []struct {
+                name    string
+                line    string
+                want    []logfmtPair
+                wantErr bool
+        }{
+                {
+                        name: "plain values",
+                        line: "level=info msg=started port=8080",
+                        want: []logfmtPair{{"level", "info"}, {"msg", "started"}, {"port", "8080"}},
+                },
+                {
+                        name: "quoted value with spaces",
+                        line: `level=error msg="connection refused by db" retries=3`,
+                        want: []logfmtPair{{"level", "error"}, {"msg", "connection refused by db"}, {"retries", "3"}},
+                },
+                {
+                        name: "escapes in a quoted value",
+                        line: `msg="said \"hi\"\tthen left" path="C:\\logs"`,
+                        want: []logfmtPair{{"msg", "said \"hi\"\tthen left"}, {"path", `C:\logs`}},
+                },
+                {
+                        name: "bare keys",
+                        line: `msg="x" retry  cached`,
+                        want: []logfmtPair{{"msg", "x"}, {"retry", ""}, {"cached", ""}},
+                },
+                {
+                        name: "empty value",
+                        line: "user= level=warn",
+                        want: []logfmtPair{{"user", ""}, {"level", "warn"}},
+                },
+                {name: "plain text", line: "connection refused by db", wantErr: true},
+                {name: "unterminated quote", line: `msg="never closed`, wantErr: true},
+                {name: "quoted key", line: `"msg"=x`, wantErr: true},
+                {name: "empty line", line: "  ", wantErr: true},
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        got, err := splitLogfmt(tt.line)
+                        if tt.wantErr {
+                                if err == nil {
+                                        t.Errorf("splitLogfmt(%q) = %q, want an error", tt.line, got)
+                                }
+                                return
+                        }
+                        if err != nil {
+                                t.Fatalf("splitLogfmt(%q): %v", tt.line, err)
+                        }
+                        if !reflect.DeepEqual(got, tt.want) {
+                                t.Errorf("splitLogfmt(%q) = %q, want %q", tt.line, got, tt.want)
+                        }
+                })
+        }
+}
+
+func TestParseLogfmtLine(t *testing.T) {
+        useTimeZone(t, time.UTC)
+        at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+        tests := []struct {
+                name     string
+                line     string
+                tsField  string
+                fields   []string
+                wantTime time.Time
+                wantText string
+                hasTime  bool
+        }{
+                {
+                        name:     "ts key, fields in order",
+                        line:     `ts=2024-01-02T15:04:05Z level=error msg="disk full on /data" retry`,
+                        wantTime: at,
+                        wantText: `2024-01-02T15:04:05Z level=error msg="disk full on /data" retry`,
+                        hasTime:  true,
+                },
+                {
+                        name:     "selected fields",
+                        line:     `time=2024-01-02T15:04:05Z level=error msg="a \"quoted\" word" caller=main.go:12`,
+                        fields:   []string{"msg", "level"},
+                        wantTime: at,
+                        wantText: `2024-01-02T15:04:05Z msg="a \"quoted\" word" level=error`,
+                        hasTime:  true,
+                },
+                {
+                        name:     "-ts-field with unix seconds",
+                        line:     "when=1704207845 msg=ok",
+                        tsField:  "when",
+                        wantTime: at,
+                        wantText: "2024-01-02T15:04:05Z msg=ok",
+                        hasTime:  true,
+                },
+                {
+                        name: "no timestamp",
+                        line: "level=info msg=ok",
+                },
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        gotTime, gotText, hasTime, err := parseLogfmtLine(tt.line, tt.tsField, tt.fields)
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        if hasTime != tt.hasTime || !gotTime.Equal(tt.wantTime) || gotText != tt.wantText {
+                                t.Errorf("parseLogfmtLine = %v, %q, %v; want %v, %q, %v", gotTime, gotText, hasTime, tt.wantTime, tt.wantText, tt.hasTime)
+                        }
+                })
+        }
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+        "fmt"
+        "log"
+        "os"
+        "strings"
+)
+
+// Log levels for -log-level
+type logLevel int
+
+const (
+        levelDebug logLevel = iota
+        levelInfo
+        levelWarn
+        levelError
+)
+
+var logLevels = map[string]logLevel{
+        "debug": levelDebug,
+        "info":  levelInfo,
+        "warn":  levelWarn,
+        "error": levelError,
+}
+
+var levelTags = map[logLevel]string{
+        levelDebug: "DEBUG",
+        levelInfo:  "INFO ",
+        levelWarn:  "WARN ",
+        levelError: "ERROR",
+}
+
+// ANSI colors per level, used only when stderr is a terminal
+var levelColors = map[logLevel]string{
+        levelDebug: "\033[90m", // Gray
+        levelInfo:  "\033[36m", // Cyan
+        levelWarn:  "\033[33m", // Yellow
+        levelError: "\033[31m", // Red
+}
+
+var (
+        minLogLevel = levelInfo
+        logColor    = false
+)
+
+// setupLogging applies -log-level and -quiet, and turns on color when stderr
+// is a terminal (unless NO_COLOR is set). It reports false for an unknown level.
+func setupLogging(level string, quiet bool) bool {
+        lvl, ok := logLevels[strings.ToLower(level)]
+        if !ok {
+                return false
+        }
+        if quiet {
+                lvl = levelError
+        }
+        minLogLevel = lvl
+
+        if info, err := os.Stderr.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == "" {
+                logColor = true
+        }
+        return true
+}
+
+func logAt(level logLevel, format string, args ...interface{}) {
+        if level < minLogLevel {
+                return
+        }
+        tag := levelTags[level]
+        if logColor {
+                tag = levelColors[level] + tag + "\033[0m"
+        }
+        log.Print(tag + " " + fmt.Sprintf(format, args...))
+}
+
+func logDebugf(format string, args ...interface{}) { logAt(levelDebug, format, args...) }
+func logInfof(format string, args ...interface{})  { logAt(levelInfo, format, args...) }
+func logWarnf(format string, args ...interface{})  { logAt(levelWarn, format, args...) }
+func logErrorf(format string, args ...interface{}) { logAt(levelError, format, args...) }
+
+// logFatalf logs at ERROR regardless of -log-level and exits with exitFatal
+func logFatalf(format string, args ...interface{}) {
+        tag := levelTags[levelError]
+        if logColor {
+                tag = levelColors[levelError] + tag + "\033[0m"
+        }
+        log.Fatal(tag + " " + fmt.Sprintf(format, args...))
+}
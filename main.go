@@ -0,0 +1,126 @@
+package main
+
+import (
+        "flag"
+        "fmt"
+        "os"
+)
+
+const usage = `Usage: log-analyzer <command> [flags]
+
+Commands:
+  analyze     filter the logs and write a chunk-by-chunk AI analysis
+  recommend   turn an analysis summary into recommendations
+  all         run analyze, then recommend on its output
+
+Run "log-analyzer <command> -h" for the flags of a command.
+` + exitCodesHelp
+
+const exitCodesHelp = `
+Exit codes:
+  0  every chunk was analyzed successfully
+  1  fatal error, e.g. invalid flags or unreadable input
+  2  partial failure: some chunks could not be analyzed
+  3  total failure: no chunk could be analyzed
+  4  interrupted by SIGINT/SIGTERM; the results so far were saved
+`
+
+// Process exit codes, see exitCodesHelp. logFatalf already exits with exitFatal.
+const (
+        exitOK      = 0
+        exitFatal   = 1
+        exitPartial = 2
+        exitFailed  = 3
+
+        exitInterrupted = 4
+)
+
+func main() {
+        if len(os.Args) < 2 {
+                fmt.Fprint(os.Stderr, usage)
+                os.Exit(exitFatal)
+        }
+
+        command, args := os.Args[1], os.Args[2:]
+        fs := flag.NewFlagSet(command, flag.ContinueOnError)
+        fs.Usage = func() {
+                fmt.Fprintf(fs.Output(), "Usage of %s:\n", command)
+                fs.PrintDefaults()
+                fmt.Fprint(fs.Output(), exitCodesHelp)
+        }
+        addCommonFlags(fs)
+        installSignalHandler()
+
+        switch command {
+        case "analyze":
+                addAnalyzeFlags(fs)
+                parseFlags(fs, args)
+                checkAnalyzeFlags()
+                if cfg.Preflight && !cfg.DryRun && !cfg.NoAI {
+                        preflight()
+                }
+                startProfiling()
+                exit(runScheduled(runAnalyze))
+        case "recommend":
+                addRecommendFlags(fs, true)
+                parseFlags(fs, args)
+                checkRecommendFlags()
+                if cfg.Preflight {
+                        preflight()
+                }
+                startProfiling()
+                if err := runRecommend(); err != nil {
+                        logFatalf("%v", err)
+                }
+                exit(exitOK)
+        case "all":
+                addAnalyzeFlags(fs)
+                addRecommendFlags(fs, false)
+                parseFlags(fs, args)
+                checkAnalyzeFlags()
+                checkRecommendFlags()
+                if cfg.Preflight && !cfg.DryRun && !cfg.NoAI {
+                        preflight()
+                }
+                startProfiling()
+                cfg.recommendNext = !cfg.NoAI && cfg.OutputPath != ""
+                exit(runScheduled(runAll))
+        case "-h", "-help", "--help", "help":
+                fmt.Fprint(os.Stdout, usage)
+        default:
+                logErrorf("Unknown command %q", command)
+                fmt.Fprint(os.Stderr, usage)
+                os.Exit(exitFatal)
+        }
+}
+
+// runAll is one pass of the all subcommand: the analysis, then the
+// recommendations on its summary. A failed recommendation pass is fatal,
+// except with -every where the next pass may fare better.
+func runAll() int {
+        code := runAnalyze()
+        if cfg.DryRun || code == exitFailed || code == exitInterrupted {
+                return code
+        }
+        if cfg.NoAI {
+                logInfof("Recommendations need the AI service, skipping them with -no-ai")
+                return code
+        }
+        if emptyWindow {
+                logInfof("No log entries to recommend anything for, skipping recommendations")
+                return code
+        }
+        if cfg.OutputPath == "" {
+                logInfof("No summary file was written (-ndjson without -out), skipping recommendations")
+                return code
+        }
+        cfg.SummaryPath = cfg.OutputPath
+        if err := runRecommend(); err != nil {
+                if cfg.Every == 0 {
+                        logFatalf("%v", err)
+                }
+                logErrorf("%v", err)
+                return exitPartial
+        }
+        return code
+}
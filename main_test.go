@@ -0,0 +1,55 @@
+package main
+
+import (
+        "errors"
+        "flag"
+        "net/http"
+        "os"
+        "path/filepath"
+        "strings"
+        "testing"
+)
+
+func TestRunAllSkipsRecommendationsForEmptyWindow(t *testing.T) {
+        requests := stubAIService(t, http.StatusOK, "", "")
+        httpClient.Transport = roundTripFunc(func(*http.Request) (*http.Response, error) {
+                requests.Add(1)
+                return nil, errors.New("no request expected")
+        })
+        t.Cleanup(func() { emptyWindow = false })
+
+        dir := t.TempDir()
+        logPath := filepath.Join(dir, "app.log")
+        // Only a line from long before the window
+        if err := os.WriteFile(logPath, []byte("2020-01-02T15:04:05Z ERROR old failure\n"), 0644); err != nil {
+                t.Fatal(err)
+        }
+        outPath, recommendPath := filepath.Join(dir, "summary.md"), filepath.Join(dir, "recommendations.md")
+        fs := flag.NewFlagSet("all", flag.ContinueOnError)
+        addCommonFlags(fs)
+        addAnalyzeFlags(fs)
+        addRecommendFlags(fs, false)
+        err := fs.Parse([]string{"-log", logPath, "-window", "1h", "-out", outPath, "-recommend-out", recommendPath,
+                "-endpoint", "http://ai.test/v1/chat/completions", "-retries", "0", "-preflight=false"})
+        if err != nil {
+                t.Fatal(err)
+        }
+        cfg.recommendNext = true
+
+        if code := runAll(); code != exitOK {
+                t.Errorf("runAll = %d, want %d", code, exitOK)
+        }
+        if n := requests.Load(); n != 0 {
+                t.Errorf("%d requests to the AI service, want none", n)
+        }
+        summary, err := os.ReadFile(outPath)
+        if err != nil {
+                t.Fatal(err)
+        }
+        if !strings.Contains(string(summary), "No log entries in window") {
+                t.Errorf("-out file doesn't report the empty window:\n%s", summary)
+        }
+        if _, err := os.Stat(recommendPath); !os.IsNotExist(err) {
+                t.Errorf("recommendations were written for an empty window (stat: %v)", err)
+        }
+}
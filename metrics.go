@@ -0,0 +1,39 @@
+package main
+
+import (
+        "fmt"
+        "strconv"
+        "strings"
+        "time"
+)
+
+// writeMetricsFile writes the run's figures to -metrics-file in the
+// Prometheus text format, for node_exporter's textfile collector. The write
+// is atomic so the collector never sees half a file.
+func writeMetricsFile(path string, stats *runStats, finished time.Time) {
+        labels := fmt.Sprintf(`{model="%s"}`, escapeLabelValue(cfg.Model))
+        metrics := []struct {
+                name, help string
+                value      float64
+        }{
+                {"log_analyzer_chunks_total", "Chunks sent to the AI service in the last run.", float64(stats.Chunks)},
+                {"log_analyzer_chunk_errors_total", "Chunks whose analysis failed in the last run.", float64(stats.Errored)},
+                {"log_analyzer_duration_seconds", "Wall-clock time of the last run.", stats.Elapsed.Seconds()},
+                {"log_analyzer_lines_scanned", "Log lines read in the last run.", float64(stats.LinesScanned)},
+                {"log_analyzer_last_run_timestamp", "Unix time the last run finished.", float64(finished.Unix())},
+        }
+
+        var b strings.Builder
+        for _, m := range metrics {
+                fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s%s %s\n",
+                        m.name, m.help, m.name, m.name, labels, strconv.FormatFloat(m.value, 'f', -1, 64))
+        }
+        if err := writeFileAtomic(path, []byte(b.String()), 0644); err != nil {
+                logWarnf("Failed to write metrics file %s: %v", path, err)
+        }
+}
+
+// escapeLabelValue escapes a Prometheus label value
+func escapeLabelValue(s string) string {
+        return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+        "fmt"
+        "regexp"
+        "strings"
+        "time"
+)
+
+// Continuation lines kept per record; the rest of a runaway trace is elided
+const maxContinuationLines = 200
+
+// logRecord is one logical log entry: a timestamped line plus the
+// continuation lines (stack trace frames etc.) that follow it.
+type logRecord struct {
+        Time   time.Time
+        Lines  []string
+        elided int
+
+        Line int // Number of the first line in its source; 0 if unknown
+}
+
+// lastLine is the number of the record's last line in its source, counting
+// elided ones; 0 if unknown
+func (r *logRecord) lastLine() int {
+        if r.Line == 0 {
+                return 0
+        }
+        return r.Line + len(r.Lines) - 1 + r.elided
+}
+
+func (r *logRecord) text() string {
+        text := strings.Join(r.Lines, "\n")
+        if r.elided > 0 {
+                text += fmt.Sprintf("\n... (%d more lines)", r.elided)
+        }
+        return text
+}
+
+// framePattern matches continuation lines that look like part of a stack
+// trace or other indented detail: indented lines, Java "Caused by:" and
+// "... 12 more", exception and error headers, Python tracebacks, Go panics
+// and their function lines, and closing brackets of multi-line values
+var framePattern = regexp.MustCompile(`^(?:\s|at |Caused by:|Suppressed:|\.\.\. \d+ |Traceback |panic:|goroutine \d+ |\[signal |[\w.$]+(?:Exception|Error|Throwable)\b|[\w.$/*()-]+\(.*\)$|[}\])])`)
+
+// multilineGrouper attaches lines without a recognizable timestamp to the
+// timestamped line before them.
+type multilineGrouper struct {
+        current *logRecord
+
+        // Continuation lines attached that don't look like trace frames, which
+        // suggests a timestamp format that isn't recognized
+        unframed int
+}
+
+// add feeds the next line. Once a new timestamped line shows the previous
+// record is complete, that record is returned. orphan is set for a
+// continuation line with no record to attach to, e.g. at the start of a file.
+// n is the line's number in its source, or 0 if unknown.
+func (g *multilineGrouper) add(line string, n int) (done *logRecord, orphan bool) {
+        t, ok := parseLogTimestamp(line)
+        if !ok {
+                if g.current == nil {
+                        return nil, true
+                }
+                if !framePattern.MatchString(line) {
+                        g.unframed++
+                }
+                if len(g.current.Lines) <= maxContinuationLines {
+                        g.current.Lines = append(g.current.Lines, line)
+                } else {
+                        g.current.elided++
+                }
+                return nil, false
+        }
+        done = g.current
+        g.current = &logRecord{Time: t, Lines: []string{line}, Line: n}
+        return done, false
+}
+
+// start begins a record found by other means than a leading timestamp, such
+// as -line-format, so the continuation lines after it still attach to it.
+// The previous record is returned as add does.
+func (g *multilineGrouper) start(record *logRecord) *logRecord {
+        done := g.current
+        g.current = record
+        return done
+}
+
+// flush returns the last record, if any
+func (g *multilineGrouper) flush() *logRecord {
+        done := g.current
+        g.current = nil
+        return done
+}
+
+// groupMultilineEntries joins continuation lines onto the entry they belong
+// to and returns one string per logical record. Orphan continuation lines
+// before the first timestamp are kept as records of their own.
+func groupMultilineEntries(lines []string) []string {
+        var records []string
+        g := &multilineGrouper{}
+        for i, line := range lines {
+                done, orphan := g.add(line, i+1)
+                if orphan {
+                        records = append(records, line)
+                }
+                if done != nil {
+                        records = append(records, done.text())
+                }
+        }
+        if last := g.flush(); last != nil {
+                records = append(records, last.text())
+        }
+        return records
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+        "fmt"
+        "reflect"
+        "strings"
+        "testing"
+        "time"
+)
+
+func TestGroupMultilineEntries(t *testing.T) {
+        useTimeZone(t, time.UTC)
+        tests := []struct {
+                name  string
+                lines []string
+                want  []string
+        }{
+                {
+                        name:  "empty input",
+                        lines: nil,
+                        want:  nil,
+                },
+                {
+                        name: "single-line entries stay separate",
+                        lines: []string{
+                                "2024-01-02T15:04:05Z INFO one",
+                                "2024-01-02T15:04:06Z INFO two",
+                        },
+                        want: []string{
+                                "2024-01-02T15:04:05Z INFO one",
+                                "2024-01-02T15:04:06Z INFO two",
+                        },
+                },
+                {
+                        name: "stack trace joins its entry",
+                        lines: []string{
+                                "2024-01-02T15:04:05Z ERROR request failed",
+                                "java.lang.IllegalStateException: boom",
+                                "    at com.example.Handler.run(Handler.java:42)",
+                                "    at java.lang.Thread.run(Thread.java:750)",
+                                "2024-01-02T15:04:06Z INFO recovered",
+                        },
+                        want: []string{
+                                "2024-01-02T15:04:05Z ERROR request failed\n" +
+                                        "java.lang.IllegalStateException: boom\n" +
+                                        "    at com.example.Handler.run(Handler.java:42)\n" +
+                                        "    at java.lang.Thread.run(Thread.java:750)",
+                                "2024-01-02T15:04:06Z INFO recovered",
+                        },
+                },
+                {
+                        name: "orphan continuation lines at the start",
+                        lines: []string{
+                                "    at com.example.Handler.run(Handler.java:42)",
+                                "    at java.lang.Thread.run(Thread.java:750)",
+                                "2024-01-02T15:04:05Z INFO first dated line",
+                                "    detail",
+                        },
+                        want: []string{
+                                "    at com.example.Handler.run(Handler.java:42)",
+                                "    at java.lang.Thread.run(Thread.java:750)",
+                                "2024-01-02T15:04:05Z INFO first dated line\n    detail",
+                        },
+                },
+                {
+                        name:  "only orphans",
+                        lines: []string{"no timestamp", "none here either"},
+                        want:  []string{"no timestamp", "none here either"},
+                },
+        }
+        for _, tt := range tests {
+                t.Run(tt.name, func(t *testing.T) {
+                        if got := groupMultilineEntries(tt.lines); !reflect.DeepEqual(got, tt.want) {
+                                t.Errorf("groupMultilineEntries = %q, want %q", got, tt.want)
+                        }
+                })
+        }
+}
+
+func TestGroupMultilineEntriesElidesLongTraces(t *testing.T) {
+        useTimeZone(t, time.UTC)
+        lines := []string{"2024-01-02T15:04:05Z ERROR runaway trace"}
+        for i := 1; i <= maxContinuationLines+50; i++ {
+                lines = append(lines, fmt.Sprintf("    at frame%d", i))
+        }
+        lines = append(lines, "2024-01-02T15:04:06Z INFO next entry")
+
+        got := groupMultilineEntries(lines)
+        if len(got) != 2 {
+                t.Fatalf("got %d records, want 2", len(got))
+        }
+        recordLines := strings.Split(got[0], "\n")
+        // The header, maxContinuationLines frames and the elision note
+        if len(recordLines) != maxContinuationLines+2 {
+                t.Errorf("record has %d lines, want %d", len(recordLines), maxContinuationLines+2)
+        }
+        if last := recordLines[len(recordLines)-1]; last != "... (50 more lines)" {
+                t.Errorf("last line = %q, want the elision note", last)
+        }
+        if frame := recordLines[maxContinuationLines]; frame != fmt.Sprintf("    at frame%d", maxContinuationLines) {
+                t.Errorf("last kept frame = %q", frame)
+        }
+        if got[1] != "2024-01-02T15:04:06Z INFO next entry" {
+                t.Errorf("next record = %q", got[1])
+        }
+}
+
+func TestLogRecordLastLineCountsElided(t *testing.T) {
+        useTimeZone(t, time.UTC)
+        g := &multilineGrouper{}
+        g.add("2024-01-02T15:04:05Z ERROR runaway trace", 10)
+        for i := 0; i < maxContinuationLines+5; i++ {
+                g.add("    at frame", 11+i)
+        }
+        record := g.flush()
+        if want := 10 + maxContinuationLines + 5; record.lastLine() != want {
+                t.Errorf("lastLine = %d, want %d", record.lastLine(), want)
+        }
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+        "encoding/json"
+        "fmt"
+        "os"
+        "strings"
+        "time"
+)
+
+// analysisHeader is the heading placed above each chunk's analysis in the text output
+func analysisHeader(chunkLabel string) string {
+        return fmt.Sprintf("=== %s ===\n\n", chunkLabel)
+}
+
+// saveProgressEnabled reports whether partial results should be written while
+// chunks are processed. With -append they would overwrite earlier summaries.
+func saveProgressEnabled() bool {
+        return cfg.Format.wantsText() && !cfg.Append && cfg.OutputPath != ""
+}
+
+// writeOutput writes a finished summary to path, replacing the file, or with
+// -append adding it after the summaries already there.
+func writeOutput(path string, data []byte) error {
+        if !cfg.Append {
+                return replaceOutput(path, data)
+        }
+        return appendOutput(path, append(data, '\n'))
+}
+
+func saveProgress(analyses []string, errs []error) {
+        var buffer strings.Builder
+
+        // Add successful analyses
+        if len(analyses) > 0 {
+                buffer.WriteString("## SUCCESSFUL ANALYSES\n\n")
+                for _, analysis := range analyses {
+                        buffer.WriteString(analysis)
+                        buffer.WriteString("\n\n---\n\n")
+                }
+        }
+
+        // Add error messages if any
+        if len(errs) > 0 {
+                buffer.WriteString("\n\n## ERRORS\n\n")
+                for _, err := range errs {
+                        buffer.WriteString(err.Error())
+                        buffer.WriteString("\n\n")
+                }
+        }
+
+        // Write the analysis to the output file
+        err := writeOutput(cfg.OutputPath, []byte(buffer.String()))
+        if err != nil {
+                logErrorf("Failed to write output file: %v", err)
+        }
+}
+
+// compileFinalSummary renders the text summary for the output sinks and
+// returns it, or "" if it could not be rendered
+func compileFinalSummary(analyses []string, errs []error, truncated int, synthesis, errorExplanation string, comparison *windowComparison, startTime, endTime time.Time, stats *runStats, volume logVolume, topErrors []topErrorRow) string {
+        data := summaryData{
+                GeneratedAt:      time.Now().In(timeZone),
+                Window:           jsonWindow{Start: startTime, End: endTime},
+                AnalysisCount:    len(analyses),
+                Synthesis:        synthesis,
+                Comparison:       comparison,
+                ErrorCount:       len(errs),
+                ErrorExplanation: errorExplanation,
+                Truncated:        truncated,
+                Interrupted:      interrupted(),
+                Usage:            currentUsage(),
+                Stats:            *stats,
+                Histogram:        volume.rows(),
+                TopErrors:        topErrors,
+        }
+        if len(errs) > 0 {
+                data.ErrorCounts = describeErrorCounts(errs)
+        }
+
+        // Add the per-severity counts for alerting scripts
+        counts, unparsed := countFindings(analyses)
+        for _, severity := range findingSeverities {
+                data.SeverityCounts = append(data.SeverityCounts, severityCount{Severity: severity, Count: counts[severity]})
+        }
+        data.UnparsedFindings = unparsed
+
+        // Keep analyses, then errors, until the summary would exceed
+        // maxCharsPerSummary. The most severe analyses get first claim on the space.
+        totalChars := 0
+        keep := make([]bool, len(analyses))
+        for _, i := range analysesByPriority(analyses, cfg.PriorityKeywords) {
+                if totalChars+len(analyses[i]) > maxCharsPerSummary {
+                        continue
+                }
+                keep[i] = true
+                totalChars += len(analyses[i])
+        }
+        for i, analysis := range analyses {
+                if keep[i] {
+                        data.Analyses = append(data.Analyses, analysis)
+                        continue
+                }
+                label, _ := splitAnalysisHeader(analysis)
+                data.DroppedAnalyses++
+                data.DroppedLabels = append(data.DroppedLabels, label)
+        }
+        if cfg.GroupBy == "component" {
+                data.Components = groupFindingsByComponent(data.Analyses)
+        }
+        for i, err := range errorMessages(errs) {
+                if totalChars+len(err) > maxCharsPerSummary {
+                        data.DroppedErrors = len(errs) - i
+                        break
+                }
+                data.Errors = append(data.Errors, err)
+                totalChars += len(err)
+        }
+
+        summary, err := renderSummary(data)
+        if err != nil {
+                logErrorf("Failed to render summary: %v", err)
+                return ""
+        }
+        return summary
+}
+
+// jsonSummary is the document written in json output mode
+type jsonSummary struct {
+        GeneratedAt time.Time   `json:"generated_at"`
+        Window      jsonWindow  `json:"window"`
+        Synthesis   string      `json:"synthesis,omitempty"`
+        Chunks      []jsonChunk `json:"chunks"`
+        Errors      []string    `json:"errors"`
+        Counts      jsonCounts  `json:"counts"`
+
+        SeverityCounts map[string]int `json:"severity_counts"`
+        Usage          usageTotals    `json:"usage"`
+        Stats          *runStats      `json:"stats,omitempty"`
+        Volume         *logVolume     `json:"volume,omitempty"`
+
+        Comparison *windowComparison `json:"comparison,omitempty"`
+}
+
+type jsonWindow struct {
+        Start time.Time `json:"start"`
+        End   time.Time `json:"end"`
+}
+
+type jsonChunk struct {
+        Label     string `json:"label"`
+        Content   string `json:"content"`
+        Truncated bool   `json:"truncated,omitempty"`
+
+        Findings []Finding `json:"findings"`
+}
+
+type jsonCounts struct {
+        Chunks     int `json:"chunks"`
+        Successful int `json:"successful"`
+        Errors     int `json:"errors"`
+        Truncated  int `json:"truncated"`
+}
+
+// writeEmptySummary records that the window held no log entries, so a
+// scheduled run still leaves a current summary behind.
+func writeEmptySummary(startTime, endTime time.Time) {
+        if cfg.Format.wantsText() {
+                var buffer strings.Builder
+                buffer.WriteString("# LOG ANALYSIS SUMMARY\n")
+                buffer.WriteString(fmt.Sprintf("Generated on %s\n\n", time.Now().In(timeZone).Format(time.RFC1123)))
+                buffer.WriteString(fmt.Sprintf("No log entries in window [%s, %s].\n",
+                        startTime.Format(time.RFC3339), endTime.Format(time.RFC3339)))
+                writeSinks(analysisSinks(), Summary{Title: "log analysis", Text: buffer.String()})
+        }
+        if cfg.OutputPath != "" && cfg.Format.wantsJSON() {
+                writeJSONSummary(nil, "", nil, startTime, endTime, nil, nil)
+        }
+}
+
+// ndjsonRecord is the -ndjson line written to stdout for each finished chunk
+type ndjsonRecord struct {
+        Chunk   int    `json:"chunk"`
+        Label   string `json:"label"`
+        OK      bool   `json:"ok"`
+        Content string `json:"content"`
+}
+
+// writeNDJSONRecord prints one chunk result as a line of JSON on stdout.
+// Callers serialize the calls so records never interleave.
+func writeNDJSONRecord(chunkNum int, r chunkResult) {
+        record := ndjsonRecord{
+                Chunk:   chunkNum,
+                Label:   r.Label,
+                OK:      r.Err == nil,
+                Content: strings.TrimPrefix(r.Analysis, analysisHeader(r.Label)),
+        }
+        if r.Err != nil {
+                record.Content = r.Err.Error()
+        }
+        data, err := json.Marshal(record)
+        if err != nil {
+                logErrorf("Failed to encode NDJSON record for %s: %v", r.Label, err)
+                return
+        }
+        // os.Stdout is unbuffered, so each record is flushed as it is written
+        os.Stdout.Write(append(data, '\n'))
+}
+
+// jsonOutputPath is where the JSON summary goes: -out itself in json mode, or
+// -out with a .json suffix alongside the text summary in both mode. A .gz
+// name keeps .gz last.
+func jsonOutputPath() string {
+        if cfg.Format == formatBoth {
+                if base, ok := strings.CutSuffix(cfg.OutputPath, ".gz"); ok {
+                        return base + ".json.gz"
+                }
+                return cfg.OutputPath + ".json"
+        }
+        return cfg.OutputPath
+}
+
+func writeJSONSummary(results []chunkResult, synthesis string, comparison *windowComparison, startTime, endTime time.Time, stats *runStats, volume *logVolume) {
+        summary := buildJSONSummary(results, synthesis, comparison, startTime, endTime, stats, volume)
+        data, err := json.MarshalIndent(summary, "", "  ")
+        if err != nil {
+                logErrorf("Failed to encode JSON summary: %v", err)
+                return
+        }
+        err = writeOutput(jsonOutputPath(), append(data, '\n'))
+        if err != nil {
+                logErrorf("Failed to write JSON output file: %v", err)
+        }
+}
+
+// buildJSONSummary assembles the json mode document from the chunk results
+func buildJSONSummary(results []chunkResult, synthesis string, comparison *windowComparison, startTime, endTime time.Time, stats *runStats, volume *logVolume) jsonSummary {
+        summary := jsonSummary{
+                GeneratedAt: time.Now().In(timeZone),
+                Synthesis:   synthesis,
+                Comparison:  comparison,
+                Window:      jsonWindow{Start: startTime, End: endTime},
+                Chunks:      []jsonChunk{},
+                Errors:      []string{},
+                Usage:       currentUsage(),
+                Stats:       stats,
+                Volume:      volume,
+        }
+        var analyses []string
+        for _, r := range results {
+                if !r.Done {
+                        continue
+                }
+                if r.Err != nil {
+                        summary.Errors = append(summary.Errors, r.Err.Error())
+                        continue
+                }
+                content := strings.TrimPrefix(r.Analysis, analysisHeader(r.Label))
+                findings := parseFindings(content)
+                if findings == nil {
+                        findings = []Finding{}
+                }
+                summary.Chunks = append(summary.Chunks, jsonChunk{
+                        Label:     r.Label,
+                        Content:   content,
+                        Truncated: r.Truncated,
+                        Findings:  findings,
+                })
+                analyses = append(analyses, content)
+                if r.Truncated {
+                        summary.Counts.Truncated++
+                }
+        }
+        summary.SeverityCounts, _ = countFindings(analyses)
+        summary.Counts.Chunks = len(results)
+        summary.Counts.Successful = len(summary.Chunks)
+        summary.Counts.Errors = len(summary.Errors)
+        return summary
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+        "context"
+        "net/http"
+        "strings"
+)
+
+// modelsURL derives the service's model listing URL from the completions
+// endpoint, e.g. .../v1/chat/completions becomes .../v1/models
+func modelsURL(endpoint string) string {
+        for _, suffix := range []string{"/chat/completions", "/completions"} {
+                if strings.HasSuffix(endpoint, suffix) {
+                        return strings.TrimSuffix(endpoint, suffix) + "/models"
+                }
+        }
+        return endpoint
+}
+
+// preflight makes sure the AI service answers before any chunk is sent, so a
+// down endpoint or a bad key fails the run at once instead of chunk by chunk.
+// Any HTTP response other than 401/403 counts as reachable: not every
+// server implements /models.
+func preflight() {
+        url := modelsURL(cfg.Endpoint)
+        ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+        defer cancel()
+        req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+        if err != nil {
+                logFatalf("Preflight: invalid endpoint %s: %v", cfg.Endpoint, err)
+        }
+        if cfg.APIKey != "" {
+                req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+        }
+
+        resp, err := httpClient.Do(req)
+        if err != nil {
+                if ctx.Err() != nil {
+                        logFatalf("Preflight: the AI service at %s did not answer within %s (skip this check with -preflight=false)", url, cfg.Timeout)
+                }
+                logFatalf("Preflight: the AI service at %s is unreachable: %v (skip this check with -preflight=false)", url, err)
+        }
+        resp.Body.Close()
+
+        switch {
+        case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+                logFatalf("Preflight: the AI service rejected the API key with %s; check -api-key or $OPENAI_API_KEY", resp.Status)
+        case resp.StatusCode >= 500:
+                logWarnf("Preflight: the AI service answered %s, continuing anyway", resp.Status)
+        default:
+                logInfof("Preflight: the AI service at %s is reachable", url)
+        }
+}
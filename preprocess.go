@@ -0,0 +1,103 @@
+package main
+
+import (
+        "bytes"
+        "fmt"
+        "os/exec"
+        "runtime"
+        "strings"
+)
+
+// preprocessEntries pipes the filtered lines through the -preprocess command,
+// one run per log source, and uses what it prints in their place. If the
+// command keeps the number of lines, each entry gets back as many output lines
+// as it sent, so multi-line records keep their time, line numbers and flags;
+// otherwise the output lines are timestamped from their own text, or the
+// previous line's time when they have none.
+func preprocessEntries(entries []logEntry, command string) ([]logEntry, error) {
+        var processed []logEntry
+        for start := 0; start < len(entries); {
+                end := start + 1
+                for end < len(entries) && entries[end].Source == entries[start].Source {
+                        end++
+                }
+                batch, err := preprocessBatch(entries[start:end], command)
+                if err != nil {
+                        return nil, err
+                }
+                processed = append(processed, batch...)
+                start = end
+        }
+        return processed, nil
+}
+
+// preprocessBatch runs the command once on the lines of a single source
+func preprocessBatch(entries []logEntry, command string) ([]logEntry, error) {
+        var input strings.Builder
+        sent := 0 // Lines written, counting each line of multi-line records
+        for _, entry := range entries {
+                input.WriteString(entry.Text)
+                input.WriteByte('\n')
+                sent += strings.Count(entry.Text, "\n") + 1
+        }
+
+        cmd := shellCommand(command)
+        cmd.Stdin = strings.NewReader(input.String())
+        var stdout, stderr bytes.Buffer
+        cmd.Stdout, cmd.Stderr = &stdout, &stderr
+        err := cmd.Run()
+        if exitErr, ok := err.(*exec.ExitError); ok {
+                return nil, &commandError{Name: "-preprocess command", ExitCode: exitErr.ExitCode(), Stderr: strings.TrimSpace(stderr.String())}
+        }
+        if err != nil {
+                return nil, fmt.Errorf("failed to run the -preprocess command: %v", err)
+        }
+
+        output := strings.TrimRight(strings.ReplaceAll(stdout.String(), "\r\n", "\n"), "\n")
+        if strings.TrimSpace(output) == "" {
+                return nil, fmt.Errorf("the -preprocess command printed nothing for %d lines of %s", sent, describeSource(entries[0].Source))
+        }
+        lines := strings.Split(output, "\n")
+        if len(lines) == sent {
+                batch := make([]logEntry, len(entries))
+                for i, entry := range entries {
+                        n := strings.Count(entry.Text, "\n") + 1
+                        batch[i] = entry
+                        batch[i].Text = strings.Join(lines[:n], "\n")
+                        lines = lines[n:]
+                }
+                return batch, nil
+        }
+
+        logDebugf("-preprocess turned %d lines of %s into %d", sent, describeSource(entries[0].Source), len(lines))
+        batch := make([]logEntry, 0, len(lines))
+        previous := entries[0].Time
+        for _, line := range lines {
+                if strings.TrimSpace(line) == "" {
+                        continue
+                }
+                if t, ok := parseLogTimestamp(line); ok {
+                        previous = t
+                }
+                // Line numbers are lost along with the mapping to the input lines
+                batch = append(batch, logEntry{Time: previous, Text: line, Source: entries[0].Source})
+        }
+        return batch, nil
+}
+
+// shellCommand runs command through the platform's shell, so -preprocess can
+// be a pipeline with arguments and quoting
+func shellCommand(command string) *exec.Cmd {
+        if runtime.GOOS == "windows" {
+                return exec.Command("cmd", "/C", command)
+        }
+        return exec.Command("sh", "-c", command)
+}
+
+// describeSource names a log source in messages
+func describeSource(source string) string {
+        if source == "" {
+                return "the log"
+        }
+        return source
+}
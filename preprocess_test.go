@@ -0,0 +1,43 @@
+package main
+
+import (
+        "runtime"
+        "testing"
+        "time"
+)
+
+func TestPreprocessKeepsMultilineRecords(t *testing.T) {
+        if runtime.GOOS == "windows" {
+                t.Skip("uses sh and sed")
+        }
+        at := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+        entries := []logEntry{
+                {Time: at, Text: "ERROR boom\n\tat Foo.bar\n\tat Foo.baz", Source: "app.log", Count: 3, Line: 10, LastLine: 12},
+                {Time: at.Add(time.Second), Text: "INFO done", Source: "app.log", Count: 1, Context: true, Line: 13, LastLine: 13},
+        }
+        tests := []struct {
+                command string
+                want    []string
+        }{
+                {"cat", []string{"ERROR boom\n\tat Foo.bar\n\tat Foo.baz", "INFO done"}},
+                {"sed s/Foo/Qux/", []string{"ERROR boom\n\tat Qux.bar\n\tat Qux.baz", "INFO done"}},
+        }
+        for _, tt := range tests {
+                t.Run(tt.command, func(t *testing.T) {
+                        got, err := preprocessEntries(entries, tt.command)
+                        if err != nil {
+                                t.Fatal(err)
+                        }
+                        if len(got) != len(entries) {
+                                t.Fatalf("got %d entries, want %d", len(got), len(entries))
+                        }
+                        for i := range got {
+                                want := entries[i]
+                                want.Text = tt.want[i]
+                                if got[i] != want {
+                                        t.Errorf("entry %d = %+v, want %+v", i, got[i], want)
+                                }
+                        }
+                })
+        }
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+        "os"
+        "runtime"
+        "runtime/pprof"
+)
+
+// Open while -cpuprofile is recording
+var cpuProfile *os.File
+
+// startProfiling starts the -cpuprofile recording, if one was asked for
+func startProfiling() {
+        if cfg.CPUProfile == "" {
+                return
+        }
+        file, err := os.Create(cfg.CPUProfile)
+        if err != nil {
+                logFatalf("Failed to create CPU profile: %v", err)
+        }
+        if err := pprof.StartCPUProfile(file); err != nil {
+                file.Close()
+                logFatalf("Failed to start CPU profile: %v", err)
+        }
+        cpuProfile = file
+}
+
+// stopProfiling finishes the CPU profile and writes the -memprofile heap
+// profile. Profiles are lost if the run ends with logFatalf.
+func stopProfiling() {
+        if cpuProfile != nil {
+                pprof.StopCPUProfile()
+                if err := cpuProfile.Close(); err != nil {
+                        logWarnf("Failed to write CPU profile: %v", err)
+                }
+                cpuProfile = nil
+        }
+        if cfg.MemProfile == "" {
+                return
+        }
+        file, err := os.Create(cfg.MemProfile)
+        if err != nil {
+                logWarnf("Failed to create memory profile: %v", err)
+                return
+        }
+        defer file.Close()
+        runtime.GC() // Up-to-date statistics of what is still live
+        if err := pprof.WriteHeapProfile(file); err != nil {
+                logWarnf("Failed to write memory profile: %v", err)
+        }
+}
+
+// exit ends the process with code once any profiles are written
+func exit(code int) {
+        stopProfiling()
+        os.Exit(code)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+        "sync"
+        "time"
+)
+
+// How many recent chunk durations the ETA is averaged over
+const progressWindow = 10
+
+// progressTracker keeps track of how far along chunk processing is and
+// estimates how long the rest will take.
+type progressTracker struct {
+        mu      sync.Mutex
+        total   int
+        done    int
+        workers int
+        started time.Time
+        recent  []time.Duration // Durations of the last progressWindow chunks
+}
+
+func newProgressTracker(total, workers int) *progressTracker {
+        if workers < 1 {
+                workers = 1
+        }
+        return &progressTracker{total: total, workers: workers}
+}
+
+// Start marks the beginning of processing.
+func (p *progressTracker) Start() {
+        p.mu.Lock()
+        p.started = time.Now()
+        p.mu.Unlock()
+}
+
+// ChunkDone records a finished chunk that took the given time.
+func (p *progressTracker) ChunkDone(took time.Duration) {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        p.done++
+        p.recent = append(p.recent, took)
+        if len(p.recent) > progressWindow {
+                p.recent = p.recent[1:]
+        }
+}
+
+// Report logs the percentage done and the estimated time remaining.
+func (p *progressTracker) Report() {
+        p.mu.Lock()
+        defer p.mu.Unlock()
+        if p.total == 0 {
+                return
+        }
+
+        percent := float64(p.done) * 100 / float64(p.total)
+        remaining := p.total - p.done
+        if remaining == 0 {
+                logInfof("Progress: %d/%d chunks (100%%), took %s",
+                        p.done, p.total, time.Since(p.started).Round(time.Second))
+                return
+        }
+        logInfof("Progress: %d/%d chunks (%.0f%%), ETA %s",
+                p.done, p.total, percent, p.eta(remaining).Round(time.Second))
+}
+
+// eta estimates the remaining time from the rolling average chunk duration.
+// Chunks run in parallel, so the remaining chunks are spread over the workers.
+func (p *progressTracker) eta(remaining int) time.Duration {
+        if len(p.recent) == 0 {
+                return 0
+        }
+        var sum time.Duration
+        for _, d := range p.recent {
+                sum += d
+        }
+        avg := sum / time.Duration(len(p.recent))
+
+        workers := p.workers
+        if workers > remaining {
+                workers = remaining
+        }
+        rounds := (remaining + workers - 1) / workers
+        return avg * time.Duration(rounds)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+        "context"
+        "sync"
+        "time"
+)
+
+// rateLimiter spaces out AI requests for -rpm; nil means no limit
+var rateLimiter *tokenBucket
+
+// tokenBucket holds at most one token, refilled once every interval, so
+// requests go out evenly spaced however many workers there are
+type tokenBucket struct {
+        mu       sync.Mutex
+        interval time.Duration // Time to refill one token
+        tokens   float64       // Negative when waiters have reserved tokens not yet refilled
+        last     time.Time
+}
+
+func newTokenBucket(perMinute float64) *tokenBucket {
+        return &tokenBucket{
+                interval: time.Duration(float64(time.Minute) / perMinute),
+                tokens:   1,
+                last:     time.Now(),
+        }
+}
+
+// wait takes a token, sleeping until it is refilled if the bucket is empty.
+// It gives up with errCancelled once a shutdown starts or ctx is done, and
+// hands the reserved token back.
+func (b *tokenBucket) wait(ctx context.Context) error {
+        b.mu.Lock()
+        now := time.Now()
+        b.tokens += float64(now.Sub(b.last)) / float64(b.interval)
+        if b.tokens > 1 {
+                b.tokens = 1
+        }
+        b.last = now
+        b.tokens--
+        delay := time.Duration(-b.tokens * float64(b.interval))
+        b.mu.Unlock()
+        if delay <= 0 {
+                return nil
+        }
+
+        logDebugf("Rate limit: waiting %s before the next request", delay.Round(time.Millisecond))
+        timer := time.NewTimer(delay)
+        defer timer.Stop()
+        select {
+        case <-timer.C:
+                return nil
+        case <-ctx.Done():
+        case <-stopDispatch:
+        }
+        b.mu.Lock()
+        b.tokens++
+        b.mu.Unlock()
+        return errCancelled
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+        "bytes"
+        "encoding/json"
+        "fmt"
+        "strings"
+        "time"
+)
+
+// runRecommend is the recommend subcommand: it turns the analyze summary into
+// a shorter overview with actionable recommendations.
+func runRecommend() error {
+        logInfof("Log summary enhancer starting...")
+
+        // Read the log summary file
+        summaryData, err := readOutput(cfg.SummaryPath)
+        if err != nil {
+                return fmt.Errorf("Failed to read summary file: %v", err)
+        }
+
+        logInfof("Read %d bytes from summary file", len(summaryData))
+
+        // JSON from -format json is condensed to its findings instead of sent as-is
+        if structured, ok := structuredSummary(summaryData); ok {
+                logInfof("Summary file is analyzer JSON, sending its findings grouped by severity (%d bytes)", len(structured))
+                summaryData = []byte(structured)
+        }
+
+        // Check if file is too large - set a reasonable limit, which the
+        // -recommend-suffix shares
+        limit := 100000 - len(cfg.RecommendSuffix)
+        if len(summaryData) > limit {
+                logInfof("Summary file is very large, truncating to last %d bytes", limit)
+                if len(summaryData) > limit {
+                        summaryData = summaryData[len(summaryData)-limit:]
+                        // Find the first newline to ensure we start at a complete line
+                        for i := 0; i < 1000 && i < len(summaryData); i++ {
+                                if summaryData[i] == '\n' {
+                                        summaryData = summaryData[i+1:]
+                                        break
+                                }
+                        }
+                }
+        }
+
+        // Send to LLM for enhancement with recommendations
+        enhancedSummary, err := enhanceSummaryWithRecommendations(string(summaryData))
+        if err != nil {
+                return fmt.Errorf("Failed to enhance summary: %v", err)
+        }
+
+        // Write the enhanced summary to the output file and any other sinks.
+        // The others still get it if the file can't be written, but the run
+        // fails then.
+        summary := Summary{Title: "recommendations", Text: enhancedSummary}
+        fileErr := fileSink{path: cfg.RecommendPath, replace: true}.Write(summary)
+        if fileErr == nil {
+                logInfof("Enhanced summary with recommendations saved to %s", cfg.RecommendPath)
+        }
+        writeSinks(finalSinks(), summary)
+        logInfof("Total token usage: %s", currentUsage())
+        if fileErr != nil {
+                return fmt.Errorf("Failed to write output file: %v", fileErr)
+        }
+        return nil
+}
+
+// Default system prompt for the recommendation pass, replaced by -recommend-prompt
+const defaultRecommendPrompt = "You are a system administrator assistant. Your task is to analyze log summaries, " +
+        "create a concise meta-summary, and provide specific actionable recommendations to address " +
+        "the issues found in the logs."
+
+func enhanceSummaryWithRecommendations(summaryText string) (string, error) {
+        logInfof("Sending request to AI service...")
+        userPrompt := fmt.Sprintf("Here is a summary of log analysis. Please create a shorter, "+
+                "more concise summary of the key issues found, and then add a section called "+
+                "\"RECOMMENDATIONS\" that lists specific, actionable steps to address the problems.\n\n%s",
+                summaryText)
+        if cfg.RecommendSuffix != "" {
+                userPrompt += "\n\n" + cfg.RecommendSuffix
+        }
+        enhancedSummary, finishReason, err := requestAnalysis(cfg.RecommendPrompt, userPrompt, "Recommendations", 0)
+        if err != nil {
+                return "", err
+        }
+        if finishReason == "length" {
+                logWarnf("The recommendations were truncated by the model's output limit")
+        }
+
+        // Format the enhanced summary
+        var buffer strings.Builder
+        buffer.WriteString("# ENHANCED LOG SUMMARY WITH RECOMMENDATIONS\n")
+        buffer.WriteString(fmt.Sprintf("Generated on %s\n\n", time.Now().In(timeZone).Format(time.RFC1123)))
+        buffer.WriteString(enhancedSummary)
+
+        // Ensure there's a recommendations section if the LLM didn't add one
+        if !strings.Contains(strings.ToUpper(enhancedSummary), "RECOMMENDATION") {
+                buffer.WriteString("\n\n## RECOMMENDATIONS\n\n")
+                buffer.WriteString("The AI did not provide specific recommendations. Please review the summary to determine appropriate actions.\n")
+        }
+
+        return buffer.String(), nil
+}
+
+// structuredSummary turns a JSON summary written by analyze into a compact
+// text listing: counts first, then the findings grouped by severity, then
+// anything the model didn't tag. ok is false for any other input, which is
+// sent as plain text.
+func structuredSummary(data []byte) (string, bool) {
+        trimmed := bytes.TrimSpace(data)
+        if len(trimmed) == 0 || trimmed[0] != '{' {
+                return "", false
+        }
+        var summary jsonSummary
+        if err := json.Unmarshal(trimmed, &summary); err != nil || summary.Chunks == nil {
+                return "", false
+        }
+
+        var b strings.Builder
+        fmt.Fprintf(&b, "# LOG ANALYSIS SUMMARY\n\nWindow: %s to %s\n",
+                summary.Window.Start.Format(time.RFC3339), summary.Window.End.Format(time.RFC3339))
+        fmt.Fprintf(&b, "Chunks analyzed: %d of %d (%d failed)\n", summary.Counts.Successful, summary.Counts.Chunks, summary.Counts.Errors)
+        var counts []string
+        for _, severity := range findingSeverities {
+                counts = append(counts, fmt.Sprintf("%s %d", severity, summary.SeverityCounts[severity]))
+        }
+        fmt.Fprintf(&b, "Findings by severity: %s\n", strings.Join(counts, ", "))
+
+        if summary.Synthesis != "" {
+                fmt.Fprintf(&b, "\n## OVERVIEW\n\n%s\n", summary.Synthesis)
+        }
+
+        bySeverity := map[string][]string{}
+        var untagged []string
+        for _, chunk := range summary.Chunks {
+                if len(chunk.Findings) == 0 {
+                        untagged = append(untagged, fmt.Sprintf("%s:\n%s", chunk.Label, strings.TrimSpace(chunk.Content)))
+                        continue
+                }
+                for _, f := range chunk.Findings {
+                        line := f.Message
+                        if f.Component != "" {
+                                line = f.Component + ": " + line
+                        }
+                        bySeverity[f.Severity] = append(bySeverity[f.Severity], fmt.Sprintf("- %s (%s)", line, chunk.Label))
+                }
+        }
+        for _, severity := range findingSeverities {
+                if lines := bySeverity[severity]; len(lines) > 0 {
+                        fmt.Fprintf(&b, "\n## %s\n\n%s\n", severity, strings.Join(lines, "\n"))
+                }
+        }
+        if len(untagged) > 0 {
+                fmt.Fprintf(&b, "\n## OTHER ANALYSES\n\n%s\n", strings.Join(untagged, "\n\n"))
+        }
+        if len(summary.Errors) > 0 {
+                fmt.Fprintf(&b, "\n## PROCESSING ERRORS\n\n%s\n", describeErrorMessages(summary.Errors))
+        }
+        return b.String(), true
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+        "bytes"
+        "encoding/json"
+        "fmt"
+        "net"
+        "os"
+        "regexp"
+        "strings"
+        "sync"
+)
+
+// redactPattern is one kind of value -redact masks
+type redactPattern struct {
+        Kind    string // Token name, e.g. IP in <IP-1>
+        Pattern *regexp.Regexp
+        Valid   func(string) bool // Optional check of each match
+}
+
+func isIP(s string) bool { return net.ParseIP(s) != nil }
+
+// defaultRedactPatterns are applied in order, so an email's domain isn't
+// masked as a separate host. Hostnames need a dot and a well-known or
+// internal top-level label, so file and class names are left alone.
+var defaultRedactPatterns = []redactPattern{
+        {"EMAIL", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), nil},
+        {"IP", regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), isIP},
+        {"IP", regexp.MustCompile(`\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`), isIP},
+        {"IP", regexp.MustCompile(`\b(?:[0-9a-fA-F]{1,4}:)+:[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{1,4})*|::[0-9a-fA-F]{1,4}(?::[0-9a-fA-F]{1,4})*`), isIP},
+        {"HOST", regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+(?:com|net|org|io|dev|cloud|local|lan|internal|intranet|corp|home|localdomain|arpa)\b`), nil},
+}
+
+// redactor replaces sensitive values with numbered tokens. The same value
+// always gets the same token, so the model can still tell entities apart,
+// and the tokens can be mapped back with restore.
+type redactor struct {
+        patterns []redactPattern
+
+        mu        sync.Mutex
+        tokens    map[string]string // Original value -> token
+        originals map[string]string // Token -> original value
+        counts    map[string]int    // Tokens handed out per kind
+}
+
+// Set by -redact
+var redactions *redactor
+
+// newRedactor builds a redactor from the default patterns plus -redact-pattern
+// entries of the form NAME=REGEXP
+func newRedactor(extra []string) (*redactor, error) {
+        patterns := append([]redactPattern{}, defaultRedactPatterns...)
+        for _, spec := range extra {
+                name, expr, ok := strings.Cut(spec, "=")
+                name = strings.ToUpper(strings.TrimSpace(name))
+                if !ok || name == "" {
+                        return nil, fmt.Errorf("%q: want NAME=REGEXP", spec)
+                }
+                re, err := regexp.Compile(expr)
+                if err != nil {
+                        return nil, fmt.Errorf("%q: %v", spec, err)
+                }
+                patterns = append(patterns, redactPattern{Kind: name, Pattern: re})
+        }
+        return &redactor{
+                patterns:  patterns,
+                tokens:    map[string]string{},
+                originals: map[string]string{},
+                counts:    map[string]int{},
+        }, nil
+}
+
+// redactLine masks a log line, leaving its leading timestamp alone
+func (r *redactor) redactLine(line string) string {
+        _, message, _ := splitLogTimestamp(line)
+        prefix := line[:len(line)-len(message)]
+        return prefix + r.redact(message)
+}
+
+func (r *redactor) redact(text string) string {
+        r.mu.Lock()
+        defer r.mu.Unlock()
+        for _, p := range r.patterns {
+                text = p.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+                        if p.Valid != nil && !p.Valid(match) {
+                                return match
+                        }
+                        return r.token(p.Kind, match)
+                })
+        }
+        return text
+}
+
+// token returns the token standing for value, handing out the next number of
+// its kind on first sight. The caller holds r.mu.
+func (r *redactor) token(kind, value string) string {
+        key := kind + "\x00" + value
+        if token, ok := r.tokens[key]; ok {
+                return token
+        }
+        r.counts[kind]++
+        token := fmt.Sprintf("<%s-%d>", kind, r.counts[kind])
+        r.tokens[key] = token
+        r.originals[token] = value
+        return token
+}
+
+// tokenPattern matches the tokens redact hands out
+var tokenPattern = regexp.MustCompile(`<[A-Z0-9_]+-\d+>`)
+
+// maskedTokenPattern matches a token after normalizeMessage masked its
+// number, which only leaves the kind worth showing
+var maskedTokenPattern = regexp.MustCompile(`<([A-Z0-9_]+)-<NUM>>`)
+
+// restore puts the original values back in place of the tokens
+func (r *redactor) restore(text string) string {
+        r.mu.Lock()
+        defer r.mu.Unlock()
+        return tokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+                if original, ok := r.originals[token]; ok {
+                        return original
+                }
+                return token
+        })
+}
+
+// unredactOutcome implements -unredact: once the model has seen everything
+// it needs, the analyses written to the summary get the real values back
+func unredactOutcome(outcome *chunkOutcome, comparison *windowComparison) {
+        for i := range outcome.Results {
+                outcome.Results[i].Analysis = redactions.restore(outcome.Results[i].Analysis)
+        }
+        for i := range outcome.Analyses {
+                outcome.Analyses[i] = redactions.restore(outcome.Analyses[i])
+        }
+        outcome.Synthesis = redactions.restore(outcome.Synthesis)
+        outcome.ErrorExplanation = redactions.restore(outcome.ErrorExplanation)
+        if comparison != nil {
+                comparison.Changes = redactions.restore(comparison.Changes)
+        }
+}
+
+// writeMap saves the token -> original value mapping as JSON, readable by the
+// owner only. It returns how many tokens were written; nothing is written
+// when no value was redacted.
+func (r *redactor) writeMap(path string) (int, error) {
+        var buffer bytes.Buffer
+        encoder := json.NewEncoder(&buffer)
+        encoder.SetEscapeHTML(false) // Keep the tokens' angle brackets readable
+        encoder.SetIndent("", "  ")
+        r.mu.Lock()
+        err := encoder.Encode(r.originals)
+        n := len(r.originals)
+        r.mu.Unlock()
+        if err != nil || n == 0 {
+                return 0, err
+        }
+        if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o004 != 0 {
+                logWarnf("%s was world-readable; earlier redaction maps in it may have been exposed", path)
+        }
+        if err := writeFileAtomic(path, buffer.Bytes(), 0600); err != nil {
+                return 0, err
+        }
+        // Some filesystems ignore the mode
+        if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o004 != 0 {
+                logWarnf("%s is world-readable (mode %v) although it holds the unredacted values", path, info.Mode().Perm())
+        }
+        return n, nil
+}
+
+// saveRedactionMap writes the -anonymize-map-out file once a run is done
+func saveRedactionMap() {
+        if redactions == nil || cfg.RedactMapPath == "" {
+                return
+        }
+        n, err := redactions.writeMap(cfg.RedactMapPath)
+        switch {
+        case err != nil:
+                logErrorf("Failed to write the redaction map: %v", err)
+        case n == 0:
+                logInfof("Nothing was redacted, not writing %s", cfg.RedactMapPath)
+        default:
+                logInfof("Redaction map with %d tokens saved to %s", n, cfg.RedactMapPath)
+        }
+}
@@ -0,0 +1,37 @@
+package main
+
+import "time"
+
+// runScheduled runs one pass of the pipeline, or with -every keeps running
+// it on that interval until a shutdown signal arrives. Each pass reads the
+// logs afresh for the most recent -window; a signal during a pass lets it
+// save its results before the loop stops.
+func runScheduled(pass func() int) int {
+        if cfg.Every == 0 {
+                return pass()
+        }
+
+        summaryPath, recommendPath := cfg.OutputPath, cfg.RecommendPath
+        logInfof("Analyzing the last %s every %s until stopped", cfg.Window, cfg.Every)
+        for {
+                started := time.Now()
+                if cfg.RotateOutput {
+                        // Each pass gets its own files, named after when it started
+                        cfg.OutputPath = rotatedPath(summaryPath, started)
+                        cfg.RecommendPath = rotatedPath(recommendPath, started)
+                }
+                code := pass()
+                if code == exitInterrupted || interrupted() {
+                        return exitInterrupted
+                }
+
+                // Passes start on a fixed cadence; one that overran starts the next at once
+                next := started.Add(cfg.Every)
+                logInfof("Pass finished with exit code %d, next pass at %s", code, next.Format(time.RFC3339))
+                select {
+                case <-time.After(time.Until(next)):
+                case <-stopDispatch:
+                        return exitInterrupted
+                }
+        }
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+        "context"
+        "encoding/json"
+        "fmt"
+        "io"
+        "net/http"
+        "net/url"
+        "strings"
+        "time"
+)
+
+// maxServeBody bounds the log text a single POST /analyze may upload
+const maxServeBody = 64 << 20
+
+// analysisServer is the -serve mode: each POST /analyze runs the same filter,
+// chunk and analyze pipeline as the command line and answers with the JSON
+// summary.
+type analysisServer struct {
+        filter    *lineFilter // Template; every request filters with its own copy
+        tokenizer Tokenizer
+        // Holds a token while an analysis runs. There is one: the token usage
+        // and other counts in the summary are process-wide.
+        slots chan struct{}
+}
+
+// serveAnalysis runs the HTTP server until a shutdown signal arrives
+func serveAnalysis(filter *lineFilter, tokenizer Tokenizer) int {
+        s := &analysisServer{filter: filter, tokenizer: tokenizer, slots: make(chan struct{}, 1)}
+        mux := http.NewServeMux()
+        mux.HandleFunc("/analyze", s.handleAnalyze)
+        mux.HandleFunc("/healthz", s.handleHealth)
+        server := &http.Server{Addr: cfg.Serve, Handler: mux}
+
+        failed := make(chan error, 1)
+        go func() {
+                failed <- server.ListenAndServe()
+        }()
+        logInfof("Serving analyses on %s (POST /analyze, GET /healthz), one at a time", cfg.Serve)
+
+        select {
+        case err := <-failed:
+                logFatalf("HTTP server failed: %v", err)
+        case <-stopDispatch:
+        }
+        ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+        defer cancel()
+        if err := server.Shutdown(ctx); err != nil {
+                logWarnf("HTTP server did not shut down cleanly: %v", err)
+        }
+        return exitInterrupted
+}
+
+func (s *analysisServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet && r.Method != http.MethodHead {
+                w.Header().Set("Allow", "GET, HEAD")
+                http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+                return
+        }
+        fmt.Fprintln(w, "ok")
+}
+
+// handleAnalyze analyzes the request body as log text, or the -log files
+// when the body is empty. The window comes from the window, or since and
+// until, query parameters; without them the -log files use -window and an
+// uploaded body is taken whole.
+func (s *analysisServer) handleAnalyze(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+                w.Header().Set("Allow", "POST")
+                http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+                return
+        }
+        select {
+        case s.slots <- struct{}{}:
+                defer func() { <-s.slots }()
+        default:
+                http.Error(w, "an analysis is already running, try again later", http.StatusTooManyRequests)
+                return
+        }
+
+        body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxServeBody))
+        if err != nil {
+                http.Error(w, fmt.Sprintf("reading request body: %v", err), http.StatusRequestEntityTooLarge)
+                return
+        }
+        uploaded := len(strings.TrimSpace(string(body))) > 0
+
+        now := time.Now().In(timeZone)
+        start, end, explicit, err := requestWindow(r.URL.Query(), now)
+        if err == nil {
+                err = checkWindowSize(start, end)
+        }
+        if err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+        }
+        if !explicit && uploaded {
+                // Uploaded text is usually an excerpt of older logs; keep all of it
+                start, end = time.Time{}, now.AddDate(100, 0, 0)
+        }
+
+        started := time.Now()
+        filter := *s.filter
+        filter.resetCounts()
+        filter.Start, filter.End = start, end
+        var entries []logEntry
+        if uploaded {
+                entries, _ = filter.scan(strings.NewReader(string(body)), "request")
+                if !explicit {
+                        filter.Start, filter.End = entrySpan(entries, now, now)
+                }
+        } else if entries, err = readLogFiles(&filter); err != nil {
+                logErrorf("Failed to read log file: %v", err)
+                http.Error(w, fmt.Sprintf("reading logs: %v", err), http.StatusInternalServerError)
+                return
+        }
+        logInfof("Request from %s: %d log lines in window [%s, %s]", r.RemoteAddr, len(entries),
+                filter.Start.Format(time.RFC3339), filter.End.Format(time.RFC3339))
+
+        window, err := prepareWindow(entries, &filter, started)
+        if err != nil {
+                logErrorf("Preprocessing failed: %v", err)
+                http.Error(w, fmt.Sprintf("preprocessing: %v", err), http.StatusInternalServerError)
+                return
+        }
+        window.analyze(&filter, s.tokenizer, nil)
+        outcome := window.Outcome
+
+        status := http.StatusOK
+        if outcome.exitCode() == exitFailed {
+                status = http.StatusBadGateway
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(status)
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "  ")
+        if err := enc.Encode(buildJSONSummary(outcome.Results, outcome.Synthesis, nil, window.Start, window.End, window.Stats, &window.Volume)); err != nil {
+                logWarnf("Failed to send the summary to %s: %v", r.RemoteAddr, err)
+        }
+}
+
+// requestWindow reads the window of a POST /analyze from its query
+// parameters, which work like the -window and -since/-until flags. explicit
+// is false when none were given and the -window default applies.
+func requestWindow(q url.Values, now time.Time) (start, end time.Time, explicit bool, err error) {
+        since, until, window := q.Get("since"), q.Get("until"), q.Get("window")
+        switch {
+        case since != "" || until != "":
+                if since == "" || until == "" {
+                        return start, end, true, fmt.Errorf("since and until must be used together")
+                }
+                if start, err = time.Parse(time.RFC3339, since); err != nil {
+                        return start, end, true, fmt.Errorf("invalid since timestamp %q (want RFC3339): %v", since, err)
+                }
+                if end, err = time.Parse(time.RFC3339, until); err != nil {
+                        return start, end, true, fmt.Errorf("invalid until timestamp %q (want RFC3339): %v", until, err)
+                }
+                if !end.After(start) {
+                        return start, end, true, fmt.Errorf("until (%s) must be after since (%s)", until, since)
+                }
+                return start.In(timeZone), end.In(timeZone), true, nil
+        case window != "":
+                d, err := time.ParseDuration(window)
+                if err != nil || d <= 0 {
+                        return start, end, true, fmt.Errorf("window must be a positive duration such as 30m, got %q", window)
+                }
+                return now.Add(-d), now, true, nil
+        }
+        return now.Add(-cfg.Window), now, false, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+        "context"
+        "os"
+        "os/signal"
+        "syscall"
+        "time"
+)
+
+var (
+        // Closed on the first SIGINT/SIGTERM to stop handing out new chunks
+        stopDispatch = make(chan struct{})
+
+        // Parent of every AI request context, cancelled once the shutdown grace
+        // period runs out so stuck requests don't hold up the exit
+        requestCtx, cancelRequests = context.WithCancel(context.Background())
+)
+
+// installSignalHandler makes the first SIGINT/SIGTERM stop dispatching chunks
+// and give in-flight requests shutdownGracePeriod to finish, so the results
+// so far can still be written. A second signal exits immediately.
+func installSignalHandler() {
+        signals := make(chan os.Signal, 2)
+        signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+        go func() {
+                sig := <-signals
+                logWarnf("Received %s: waiting up to %s for in-flight chunks, then saving results (signal again to exit immediately)",
+                        sig, shutdownGracePeriod)
+                close(stopDispatch)
+                time.AfterFunc(shutdownGracePeriod, cancelRequests)
+
+                sig = <-signals
+                logWarnf("Received %s again, exiting without saving", sig)
+                os.Exit(exitInterrupted)
+        }()
+}
+
+// interrupted reports whether a shutdown signal has been received
+func interrupted() bool {
+        select {
+        case <-stopDispatch:
+                return true
+        default:
+                return false
+        }
+}
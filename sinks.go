@@ -0,0 +1,107 @@
+package main
+
+import (
+        "fmt"
+        "os"
+        "strings"
+)
+
+// Summary is a finished report on its way to the output sinks
+type Summary struct {
+        Title string // What the report is, for log messages
+        Text  string
+}
+
+// OutputSink is one destination for a finished summary. String names it in
+// log messages.
+type OutputSink interface {
+        Write(summary Summary) error
+        String() string
+}
+
+// fileSink writes the summary to a file, after the summaries already there
+// with -append unless replace is set
+type fileSink struct {
+        path    string
+        replace bool
+}
+
+func (s fileSink) Write(summary Summary) error {
+        if s.replace {
+                return replaceOutput(s.path, []byte(summary.Text))
+        }
+        return writeOutput(s.path, []byte(summary.Text))
+}
+
+func (s fileSink) String() string { return s.path }
+
+// stdoutSink prints the summary for -stdout
+type stdoutSink struct{}
+
+func (stdoutSink) Write(summary Summary) error {
+        text := summary.Text
+        if !strings.HasSuffix(text, "\n") {
+                text += "\n"
+        }
+        _, err := fmt.Fprint(os.Stdout, text)
+        return err
+}
+
+func (stdoutSink) String() string { return "stdout" }
+
+// syslogSink sends the summary to the local syslog for -syslog
+type syslogSink struct{}
+
+func (syslogSink) Write(summary Summary) error { return writeSyslog(summary.Text) }
+
+func (syslogSink) String() string { return "syslog" }
+
+// webhookSink posts the summary to -webhook-url
+type webhookSink struct{}
+
+func (webhookSink) Write(summary Summary) error { return postWebhook(summary.Text) }
+
+func (webhookSink) String() string { return "the webhook" }
+
+// analysisSinks are where the analyze summary goes. With all, stdout and the
+// webhook get the recommendations instead, unless the window was empty and
+// there won't be any.
+func analysisSinks() []OutputSink {
+        var sinks []OutputSink
+        if cfg.OutputPath != "" && cfg.Format.wantsText() {
+                sinks = append(sinks, fileSink{path: cfg.OutputPath})
+        }
+        if cfg.Syslog {
+                sinks = append(sinks, syslogSink{})
+        }
+        if !cfg.recommendNext || emptyWindow {
+                sinks = append(sinks, finalSinks()...)
+        }
+        return sinks
+}
+
+// finalSinks are the sinks only the last report of a run is sent to; the
+// recommendations also go to them after -recommend-out
+func finalSinks() []OutputSink {
+        var sinks []OutputSink
+        if cfg.Stdout {
+                sinks = append(sinks, stdoutSink{})
+        }
+        if cfg.WebhookURL != "" {
+                sinks = append(sinks, webhookSink{})
+        }
+        return sinks
+}
+
+// writeSinks sends the summary to every sink. A sink that fails is logged
+// and doesn't keep the summary from the others. Returns how many failed.
+func writeSinks(sinks []OutputSink, summary Summary) int {
+        failed := 0
+        for _, sink := range sinks {
+                if err := sink.Write(summary); err != nil {
+                        logErrorf("Failed to write the %s to %s: %v", summary.Title, sink, err)
+                        failed++
+                }
+        }
+        return failed
+}
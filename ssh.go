@@ -0,0 +1,103 @@
+package main
+
+import (
+        "fmt"
+        "io"
+        "net/url"
+        "os/exec"
+        "path"
+        "strings"
+        "time"
+)
+
+// Exit status ssh uses for its own failures: connection refused, bad host,
+// authentication and the like
+const sshFailureStatus = 255
+
+// Slack on the remote window filter, which compares timestamps as text and so
+// ignores their zone offsets. The exact window is applied locally as usual.
+const sshWindowSlack = 24 * time.Hour
+
+func isSSHPath(p string) bool {
+        return strings.HasPrefix(p, "ssh://")
+}
+
+// sshTarget is a parsed ssh://[user@]host[:port]/path log location
+type sshTarget struct {
+        Dest string // [user@]host
+        Port string
+        Path string
+}
+
+func parseSSHPath(p string) (sshTarget, error) {
+        u, err := url.Parse(p)
+        if err != nil {
+                return sshTarget{}, err
+        }
+        if u.Hostname() == "" || u.Path == "" || u.Path == "/" {
+                return sshTarget{}, fmt.Errorf("want ssh://[user@]host[:port]/path/to/log, got %s", p)
+        }
+        target := sshTarget{Dest: u.Hostname(), Port: u.Port(), Path: u.Path}
+        if u.User != nil {
+                target.Dest = u.User.Username() + "@" + target.Dest
+        }
+        return target, nil
+}
+
+// openSSHLog streams a remote log through ssh. ssh runs in batch mode so a
+// missing key fails instead of prompting. For uncompressed logs an awk filter
+// on the remote side skips lines with ISO 8601 timestamps well before the
+// window and stops after it, so only about the window crosses the network;
+// logs in other formats are sent whole.
+func openSSHLog(p string, start, end time.Time) (io.ReadCloser, error) {
+        target, err := parseSSHPath(p)
+        if err != nil {
+                return nil, err
+        }
+        sshPath, err := exec.LookPath("ssh")
+        if err != nil {
+                return nil, fmt.Errorf("ssh not found in PATH; ssh:// logs need the OpenSSH client")
+        }
+
+        remote := "cat " + shellQuote(target.Path)
+        if cfg.LastN > 0 && !strings.HasSuffix(target.Path, ".gz") {
+                remote = fmt.Sprintf("tail -n %d %s", cfg.LastN, shellQuote(target.Path))
+        } else if !strings.HasSuffix(target.Path, ".gz") {
+                const layout = "2006-01-02T15:04:05"
+                remote = fmt.Sprintf(`awk -v s=%s -v e=%s '{ t = substr($0, 1, 19); sub(" ", "T", t); iso = t ~ /^[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]T/ } !on && (!iso || t >= s) { on = 1 } on && iso && t > e { exit } on' %s`,
+                        start.Add(-sshWindowSlack).UTC().Format(layout), end.Add(sshWindowSlack).UTC().Format(layout), shellQuote(target.Path))
+        }
+
+        args := []string{"-o", "BatchMode=yes"}
+        if target.Port != "" {
+                args = append(args, "-p", target.Port)
+        }
+        args = append(args, target.Dest, "--", remote)
+        stream, err := startCommand(exec.Command(sshPath, args...), "ssh "+target.Dest)
+        if err != nil {
+                return nil, err
+        }
+        return decompressInput(target.Path, stream)
+}
+
+// isSSHFailure reports whether err is ssh itself failing to connect or
+// authenticate, as opposed to the remote command failing
+func isSSHFailure(err error) bool {
+        cmdErr, ok := err.(*commandError)
+        return ok && strings.HasPrefix(cmdErr.Name, "ssh ") && cmdErr.ExitCode == sshFailureStatus
+}
+
+// sshSourceName labels lines from a remote log with its host and file name
+func sshSourceName(p string) string {
+        target, err := parseSSHPath(p)
+        if err != nil {
+                return p
+        }
+        host := target.Dest[strings.Index(target.Dest, "@")+1:]
+        return host + ":" + path.Base(target.Path)
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+        return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
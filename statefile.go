@@ -0,0 +1,188 @@
+package main
+
+import (
+        "bytes"
+        "crypto/sha256"
+        "encoding/hex"
+        "encoding/json"
+        "io"
+        "os"
+        "strings"
+        "time"
+)
+
+// runState is the -state-file record of how far earlier runs got, so the next
+// run only analyzes what was logged since
+type runState struct {
+        LastTime time.Time           `json:"last_time"`         // Timestamp of the newest line analyzed
+        Offsets  map[string]int64    `json:"offsets,omitempty"` // Bytes read from each plain -log file
+        Heads    map[string]fileHead `json:"heads,omitempty"`   // Start of each, to tell when it was replaced
+}
+
+// fileHead identifies a log file across runs by a hash of its first bytes,
+// which stay the same as the file grows, unlike an inode that can't be kept
+// portably and is reused after rotation
+type fileHead struct {
+        Size   int    `json:"size"` // Bytes hashed, up to headSize
+        SHA256 string `json:"sha256"`
+}
+
+// headSize is how much of a log file its fileHead covers
+const headSize = 1024
+
+// readFileHead hashes the first n bytes of file, or all of it if shorter
+func readFileHead(file *os.File, n int) (fileHead, error) {
+        buf := make([]byte, n)
+        read, err := file.ReadAt(buf, 0)
+        if err != nil && err != io.EOF {
+                return fileHead{}, err
+        }
+        sum := sha256.Sum256(buf[:read])
+        return fileHead{Size: read, SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// loadRunState reads the state file. It returns nil when there is none yet,
+// or when it can't be read, so the run falls back to the normal window.
+func loadRunState(path string) *runState {
+        data, err := os.ReadFile(path)
+        if os.IsNotExist(err) {
+                logInfof("No state file %s yet, analyzing the normal window", path)
+                return nil
+        }
+        var state runState
+        if err == nil {
+                err = json.Unmarshal(data, &state)
+        }
+        if err != nil {
+                logWarnf("Ignoring unreadable state file %s: %v", path, err)
+                return nil
+        }
+        return &state
+}
+
+// saveRunState replaces the state file in one step, so an interrupted write
+// never leaves it half written
+func saveRunState(path string, state *runState) {
+        data, err := json.MarshalIndent(state, "", "  ")
+        if err == nil {
+                err = writeFileAtomic(path, append(data, '\n'), 0644)
+        }
+        if err != nil {
+                logErrorf("Failed to update state file %s: %v", path, err)
+                return
+        }
+        logDebugf("Saved run state to %s", path)
+}
+
+// logOffsets holds where each plain -log file is to be read from with
+// -state-file, and is advanced by openStatefulLog's readers as they go. With
+// -follow it records how far the first pass read.
+var logOffsets map[string]int64
+
+// logHeads holds the fileHead of each plain -log file read with -state-file
+var logHeads map[string]fileHead
+
+// openedLogs is the file each plain -log path was read from by
+// openStatefulLog, so -follow can tell whether it was rotated since
+var openedLogs map[string]os.FileInfo
+
+// resumedAfter is the timestamp of the newest line the last -state-file run
+// analyzed, or zero when this run doesn't continue from one
+var resumedAfter time.Time
+
+// resumeStart is where filtering path starts when continuing after
+// resumedAfter. A file read on from its saved byte offset starts at that
+// time, since lines stamped in the same second may have been written after
+// the last run; the offset already skips the lines analyzed before. Inputs
+// read from the top again (ssh, .gz, stdin) start just after it.
+func resumeStart(path string) time.Time {
+        if logOffsets[path] > 0 && path != "-" && !strings.HasSuffix(path, ".gz") && !isSSHPath(path) {
+                return resumedAfter
+        }
+        return resumedAfter.Add(time.Nanosecond)
+}
+
+// openStatefulLog opens a -log file for a -state-file run, starting at the
+// offset the last run stopped at. A file that starts differently than it did
+// then, or is shorter than that offset, was rotated and is read from the top.
+// Compressed files and stdin are read whole, as offsets into them can't be
+// resumed.
+func openStatefulLog(path string) (io.ReadCloser, error) {
+        if path == "-" || strings.HasSuffix(path, ".gz") {
+                return openLogInput(path)
+        }
+        file, err := os.Open(path)
+        if err != nil {
+                return nil, err
+        }
+        var magic [2]byte
+        if n, _ := file.ReadAt(magic[:], 0); n == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+                // Compressed without a .gz name, as openLogInput would find
+                file.Close()
+                delete(logOffsets, path)
+                delete(logHeads, path)
+                return openLogInput(path)
+        }
+        info, err := file.Stat()
+        if err != nil {
+                file.Close()
+                return nil, err
+        }
+        openedLogs[path] = info
+        offset := logOffsets[path]
+        if saved, ok := logHeads[path]; ok && offset > 0 {
+                if head, err := readFileHead(file, saved.Size); err != nil || head != saved {
+                        logInfof("%s starts differently than when it was last read, assuming it was rotated and reading from the top", path)
+                        offset = 0
+                }
+        }
+        if offset > info.Size() {
+                logInfof("%s is shorter than when it was last read, assuming it was rotated and reading from the top", path)
+                offset = 0
+        }
+        if head, err := readFileHead(file, headSize); err == nil {
+                logHeads[path] = head
+        }
+        if _, err := file.Seek(offset, io.SeekStart); err != nil {
+                file.Close()
+                return nil, err
+        }
+        if offset > 0 {
+                logInfof("Reading %s from byte %d, where the last run stopped", path, offset)
+        }
+        return &offsetReader{ReadCloser: file, path: path, pos: offset}, nil
+}
+
+// offsetReader records in logOffsets the position just past the last
+// complete line read, so a line still being written is read again in full
+// next time
+type offsetReader struct {
+        io.ReadCloser
+        path string
+        pos  int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+        n, err := r.ReadCloser.Read(p)
+        if i := bytes.LastIndexByte(p[:n], '\n'); i >= 0 {
+                logOffsets[r.path] = r.pos + int64(i) + 1
+        }
+        r.pos += int64(n)
+        return n, err
+}
+
+// nextRunState is the state to save after a successful run over entries: the
+// newest of their timestamps, or the last run's if none is newer, and the
+// offsets the files were read up to
+func nextRunState(previous *runState, entries []logEntry) *runState {
+        next := &runState{Offsets: logOffsets, Heads: logHeads}
+        if previous != nil {
+                next.LastTime = previous.LastTime
+        }
+        for _, entry := range entries {
+                if entry.Time.After(next.LastTime) {
+                        next.LastTime = entry.Time
+                }
+        }
+        return next
+}
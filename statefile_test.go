@@ -0,0 +1,69 @@
+package main
+
+import (
+        "bytes"
+        "compress/gzip"
+        "io"
+        "os"
+        "path/filepath"
+        "testing"
+)
+
+// useLogState gives the test empty per-file read state, as a -state-file run
+// without a saved state starts with, and restores the old state afterwards
+func useLogState(t *testing.T) {
+        t.Helper()
+        savedOffsets, savedHeads, savedOpened := logOffsets, logHeads, openedLogs
+        t.Cleanup(func() { logOffsets, logHeads, openedLogs = savedOffsets, savedHeads, savedOpened })
+        logOffsets, logHeads, openedLogs = map[string]int64{}, map[string]fileHead{}, map[string]os.FileInfo{}
+}
+
+// readStatefulLog reads path as a -state-file run does
+func readStatefulLog(t *testing.T, path string) string {
+        t.Helper()
+        reader, err := openStatefulLog(path)
+        if err != nil {
+                t.Fatal(err)
+        }
+        defer reader.Close()
+        data, err := io.ReadAll(reader)
+        if err != nil {
+                t.Fatal(err)
+        }
+        return string(data)
+}
+
+func TestStatefulLogResumesAndNoticesRotation(t *testing.T) {
+        useLogState(t)
+        path := filepath.Join(t.TempDir(), "app.log")
+        writeLog(t, path, "2024-01-02T15:00:00Z INFO one\n")
+        if got := readStatefulLog(t, path); got != "2024-01-02T15:00:00Z INFO one\n" {
+                t.Errorf("first run read %q", got)
+        }
+
+        appendLog(t, path, "2024-01-02T15:00:01Z INFO two\n")
+        if got := readStatefulLog(t, path); got != "2024-01-02T15:00:01Z INFO two\n" {
+                t.Errorf("second run read %q, want only the new line", got)
+        }
+
+        // Rotated, and the new file already longer than the saved offset
+        rotated := "2024-01-02T16:00:00Z INFO new file, first line\n2024-01-02T16:00:01Z INFO new file, second line\n"
+        writeLog(t, path, rotated)
+        if got := readStatefulLog(t, path); got != rotated {
+                t.Errorf("after rotation read %q, want the whole new file", got)
+        }
+}
+
+func TestStatefulLogSniffsGzip(t *testing.T) {
+        useLogState(t)
+        var compressed bytes.Buffer
+        zw := gzip.NewWriter(&compressed)
+        zw.Write([]byte("2024-01-02T15:00:00Z INFO compressed\n"))
+        zw.Close()
+        path := filepath.Join(t.TempDir(), "app.log.1")
+        writeLog(t, path, compressed.String())
+
+        if got := readStatefulLog(t, path); got != "2024-01-02T15:00:00Z INFO compressed\n" {
+                t.Errorf("read %q, want the decompressed text", got)
+        }
+}
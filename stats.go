@@ -0,0 +1,50 @@
+package main
+
+import "time"
+
+// runStats are the processing figures shown at the end of the summary. They
+// are filled in as the run goes, starting when the logs are first read.
+type runStats struct {
+        Started time.Time `json:"-"`
+
+        LinesScanned  int `json:"lines_scanned"`
+        LinesInWindow int `json:"lines_in_window"`
+        LinesKept     int `json:"lines_after_filters"`
+
+        LinesUnparsed   int      `json:"lines_unparsed"` // No usable timestamp, or malformed
+        UnparsedSamples []string `json:"unparsed_samples,omitempty"`
+        UnparsedKept    bool     `json:"unparsed_analyzed,omitempty"`
+        LinesUnframed   int      `json:"lines_unframed,omitempty"` // Of LinesUnparsed, attached to the line before them
+
+        Chunks     int `json:"chunks"`
+        Successful int `json:"successful_chunks"`
+        Errored    int `json:"errored_chunks"`
+
+        // Set when -max-bytes held back some of the chunks
+        CapBytes      int `json:"input_cap_bytes,omitempty"`
+        CapLinesSent  int `json:"lines_sent,omitempty"`
+        CapLinesTotal int `json:"lines_before_cap,omitempty"`
+
+        Elapsed        time.Duration `json:"-"`
+        ElapsedSeconds float64       `json:"elapsed_seconds"`
+}
+
+func newRunStats(started time.Time, filter *lineFilter, kept int) *runStats {
+        return &runStats{
+                Started:       started,
+                LinesScanned:  filter.Scanned,
+                LinesInWindow: filter.InWindow,
+                LinesKept:     kept,
+
+                LinesUnparsed:   filter.unparsedLines(),
+                UnparsedSamples: filter.Unparsed,
+                UnparsedKept:    filter.KeepUnparsed,
+                LinesUnframed:   filter.Unframed,
+        }
+}
+
+// finish records the wall-clock time up to now
+func (s *runStats) finish() {
+        s.Elapsed = time.Since(s.Started).Round(time.Millisecond)
+        s.ElapsedSeconds = s.Elapsed.Seconds()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+        "bufio"
+        "encoding/json"
+        "fmt"
+        "io"
+        "os"
+        "strings"
+)
+
+// readEventStream assembles a -stream response from its text/event-stream
+// "data:" events, echoing the content deltas to stderr as they arrive. It
+// returns an equivalent non-streaming response body so the rest of the
+// response handling doesn't need to know the reply was streamed.
+func readEventStream(r io.Reader) ([]byte, error) {
+        var content strings.Builder
+        finishReason := ""
+
+        scanner := bufio.NewScanner(r)
+        scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+        for scanner.Scan() {
+                line := strings.TrimSpace(scanner.Text())
+                if !strings.HasPrefix(line, "data:") {
+                        continue // Blank separators, comments and event/id fields
+                }
+                data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+                if data == "[DONE]" {
+                        break
+                }
+
+                var event map[string]interface{}
+                if err := json.Unmarshal([]byte(data), &event); err != nil {
+                        logWarnf("Skipping unparseable stream event: %v", err)
+                        continue
+                }
+                // Hand an error event back as the body so it is reported like any other
+                if _, hasError := event["error"]; hasError {
+                        return []byte(data), nil
+                }
+
+                choices, _ := event["choices"].([]interface{})
+                if len(choices) == 0 {
+                        continue
+                }
+                choice, _ := choices[0].(map[string]interface{})
+                // Chat streams send deltas, the completions API plain text fragments
+                text, ok := choice["text"].(string)
+                if delta, isChat := choice["delta"].(map[string]interface{}); isChat {
+                        text, ok = delta["content"].(string)
+                }
+                if ok {
+                        fmt.Fprint(os.Stderr, text)
+                        content.WriteString(text)
+                }
+                if reason, ok := choice["finish_reason"].(string); ok {
+                        finishReason = reason
+                }
+        }
+        fmt.Fprintln(os.Stderr)
+        if err := scanner.Err(); err != nil {
+                return nil, fmt.Errorf("Failed to read response stream: %v", err)
+        }
+
+        choice := map[string]interface{}{"finish_reason": finishReason}
+        if cfg.APIStyle == apiCompletions {
+                choice["text"] = content.String()
+        } else {
+                choice["message"] = map[string]interface{}{"role": "assistant", "content": content.String()}
+        }
+        return json.Marshal(map[string]interface{}{"choices": []interface{}{choice}})
+}
@@ -0,0 +1,53 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+        "fmt"
+        "log/syslog"
+        "strings"
+)
+
+// maxSyslogMessage keeps each message under the 2 KiB many syslog daemons
+// and relays accept
+const maxSyslogMessage = 2000
+
+var syslogFacilities = map[string]syslog.Priority{
+        "kern": syslog.LOG_KERN, "user": syslog.LOG_USER, "mail": syslog.LOG_MAIL,
+        "daemon": syslog.LOG_DAEMON, "auth": syslog.LOG_AUTH, "syslog": syslog.LOG_SYSLOG,
+        "lpr": syslog.LOG_LPR, "news": syslog.LOG_NEWS, "uucp": syslog.LOG_UUCP,
+        "cron": syslog.LOG_CRON, "authpriv": syslog.LOG_AUTHPRIV, "ftp": syslog.LOG_FTP,
+        "local0": syslog.LOG_LOCAL0, "local1": syslog.LOG_LOCAL1, "local2": syslog.LOG_LOCAL2,
+        "local3": syslog.LOG_LOCAL3, "local4": syslog.LOG_LOCAL4, "local5": syslog.LOG_LOCAL5,
+        "local6": syslog.LOG_LOCAL6, "local7": syslog.LOG_LOCAL7,
+}
+
+// checkSyslogFlags validates -syslog-facility
+func checkSyslogFlags() {
+        if _, ok := syslogFacilities[strings.ToLower(cfg.SyslogFacility)]; !ok {
+                logFatalf("Invalid -syslog-facility %q (want e.g. user, daemon or local0 to local7)", cfg.SyslogFacility)
+        }
+}
+
+// writeSyslog sends the summary to the local syslog daemon as info messages,
+// numbered when it has to be split
+func writeSyslog(summary string) error {
+        facility := syslogFacilities[strings.ToLower(cfg.SyslogFacility)]
+        w, err := syslog.New(facility|syslog.LOG_INFO, cfg.SyslogTag)
+        if err != nil {
+                return err
+        }
+        defer w.Close()
+
+        parts := splitMessage(summary, maxSyslogMessage-16) // Room for the "(i/n) " prefix
+        for i, part := range parts {
+                if len(parts) > 1 {
+                        part = fmt.Sprintf("(%d/%d) %s", i+1, len(parts), part)
+                }
+                if err := w.Info(part); err != nil {
+                        return fmt.Errorf("after %d of %d messages: %v", i, len(parts), err)
+                }
+        }
+        logInfof("Sent the summary to syslog (%d messages)", len(parts))
+        return nil
+}
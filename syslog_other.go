@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package main
+
+import "runtime"
+
+// checkSyslogFlags turns -syslog off where log/syslog isn't available
+func checkSyslogFlags() {
+        logWarnf("-syslog is not supported on %s; the summary will not be sent to syslog", runtime.GOOS)
+        cfg.Syslog = false
+}
+
+func writeSyslog(summary string) error { return nil }
@@ -0,0 +1,186 @@
+package main
+
+import (
+        "fmt"
+        "os"
+        "strings"
+        "text/template"
+        "time"
+)
+
+// summaryData is what -template templates are executed against
+type summaryData struct {
+        GeneratedAt time.Time
+        Window      jsonWindow
+
+        Analyses        []string // Chunk analyses that fit in the size limit
+        AnalysisCount   int      // All successful analyses, including dropped ones
+        DroppedAnalyses int
+        DroppedLabels   []string // Chunk labels of the dropped analyses
+        Synthesis       string
+
+        Comparison *windowComparison // Set with -compare
+
+        Errors           []string // Chunk errors that fit in the size limit
+        ErrorCount       int
+        DroppedErrors    int
+        ErrorCounts      string // e.g. "2 connection errors, 1 parse error"
+        ErrorExplanation string
+
+        Truncated        int // Analyses cut off by the model's output limit
+        Interrupted      bool
+        SeverityCounts   []severityCount
+        UnparsedFindings int              // Analyses no tagged findings could be read from
+        Components       []componentGroup // Set instead of chunk order with -group-by component
+        Usage            usageTotals
+        Stats            runStats
+        Histogram        []histogramRow // Log volume per -bucket
+        TopErrors        []topErrorRow  // Most frequent error messages with -top-errors
+}
+
+// topErrorRow is one line of the -top-errors table
+type topErrorRow struct {
+        Rank    int
+        Count   int
+        First   string // Times the message was first and last seen, "-" if unknown
+        Last    string
+        Message string // With numbers and IDs masked
+}
+
+type severityCount struct {
+        Severity string
+        Count    int
+}
+
+// defaultSummaryTemplate renders the standard markdown summary
+const defaultSummaryTemplate = `# LOG ANALYSIS SUMMARY
+Generated on {{.GeneratedAt.Format "Mon, 02 Jan 2006 15:04:05 MST"}}
+
+Processed {{.AnalysisCount}} chunks of logs from {{.Window.Start.Format "2006-01-02T15:04:05Z07:00"}} to {{.Window.End.Format "2006-01-02T15:04:05Z07:00"}}.
+{{if .ErrorCount}}Encountered {{.ErrorCount}} errors during processing ({{.ErrorCounts}}).
+{{end}}{{if .Interrupted}}The run was interrupted before every chunk was analyzed, so this summary is incomplete.
+{{end}}{{if .Truncated}}{{.Truncated}} analyses were truncated by the model's output limit, so this summary may be incomplete.
+{{end}}
+---
+
+{{if .TopErrors}}## TOP ERRORS
+
+| # | Count | First seen | Last seen | Message |
+|---|-------|------------|-----------|---------|
+{{range .TopErrors}}{{printf "| %d | %5d |" .Rank .Count}} {{.First}} | {{.Last}} | {{.Message}} |
+{{end}}
+---
+
+{{end}}{{if .Histogram}}## LOG VOLUME
+
+{{range .Histogram}}    {{.Label}} | {{.Bar}} {{.Count}}
+{{end}}
+---
+
+{{end}}## FINDINGS BY SEVERITY
+
+| Severity | Count |
+|----------|-------|
+{{range .SeverityCounts}}{{printf "| %-8s | %5d |" .Severity .Count}}
+{{end}}{{if .UnparsedFindings}}
+*Note: no tagged findings could be read from {{.UnparsedFindings}} analyses; they are counted as zero.*
+{{end}}
+---
+
+{{if .Synthesis}}## SYNTHESIZED SUMMARY
+
+{{.Synthesis}}
+
+---
+
+{{end}}{{with .Comparison}}## NEW OR CHANGED ISSUES
+
+*Compared with the baseline window {{.Baseline.Start.Format "2006-01-02T15:04:05Z07:00"}} to {{.Baseline.End.Format "2006-01-02T15:04:05Z07:00"}}*
+
+{{.Changes}}
+
+---
+
+{{end}}{{if .Components}}## FINDINGS BY COMPONENT
+
+{{range .Components}}### {{.Component}}
+
+{{range .Findings}}- [{{.Severity}}] {{.Message}}{{if .Chunk}} ({{.Chunk}}){{end}}
+{{end}}{{if .Findings}}
+{{end}}{{range .Unparsed}}{{.}}
+
+{{end}}{{end}}---
+
+{{else}}## DETAILED FINDINGS
+
+{{range .Analyses}}{{.}}
+
+---
+
+{{end}}{{end}}{{if .DroppedAnalyses}}
+
+*Note: {{.DroppedAnalyses}} additional analyses were truncated due to size limits.*
+{{if .DroppedLabels}}*Dropped: {{range $i, $label := .DroppedLabels}}{{if $i}}, {{end}}{{$label}}{{end}}*
+{{end}}{{end}}{{if .ErrorCount}}
+
+## ERRORS
+
+{{.ErrorCounts}}
+
+{{if .ErrorExplanation}}### Likely cause
+
+{{.ErrorExplanation}}
+
+{{end}}{{range .Errors}}{{.}}
+
+{{end}}{{if .DroppedErrors}}
+
+*Note: {{.DroppedErrors}} additional errors were truncated due to size limits.*
+{{end}}{{end}}{{with .Stats}}{{if .LinesUnparsed}}## PARSE WARNINGS
+
+{{.LinesUnparsed}} of {{.LinesScanned}} lines had no recognizable timestamp or could not be parsed{{if .UnparsedKept}}; they were analyzed undated{{else}} and were not analyzed{{end}}.{{if .LinesUnframed}} Of these, {{.LinesUnframed}} were analyzed as part of the line before them, though they don't look like stack frames; check -ts-layout.{{end}}
+{{if .UnparsedSamples}}Examples:
+
+{{range .UnparsedSamples}}    {{.}}
+{{end}}{{end}}
+{{end}}{{end}}## PROCESSING STATISTICS
+
+- Lines scanned: {{.Stats.LinesScanned}}
+- Lines in window: {{.Stats.LinesInWindow}}
+- Lines after filters: {{.Stats.LinesKept}}
+- Chunks: {{.Stats.Chunks}} ({{.Stats.Successful}} successful, {{.Stats.Errored}} errors)
+{{if .Stats.CapBytes}}- Input capped at {{.Stats.CapBytes}} bytes by -max-bytes: {{.Stats.CapLinesSent}} of {{.Stats.CapLinesTotal}} lines sent
+{{end}}- Wall-clock time: {{.Stats.Elapsed}}
+{{if .Usage.Requests}}- Token usage: {{.Usage}}
+{{end}}`
+
+// summaryTemplate is the parsed -template, or the default
+var summaryTemplate = template.Must(template.New("summary").Parse(defaultSummaryTemplate))
+
+// loadSummaryTemplate replaces the default summary template with the file
+// given to -template
+func loadSummaryTemplate(path string) error {
+        data, err := os.ReadFile(path)
+        if err != nil {
+                return err
+        }
+        tmpl, err := template.New(path).Parse(string(data))
+        if err != nil {
+                return err
+        }
+        summaryTemplate = tmpl
+        return nil
+}
+
+// renderSummary executes the summary template
+func renderSummary(data summaryData) (string, error) {
+        var buffer strings.Builder
+        if err := summaryTemplate.Execute(&buffer, data); err != nil {
+                name := "default template"
+                if cfg.TemplatePath != "" {
+                        name = "-template " + cfg.TemplatePath
+                }
+                return "", fmt.Errorf("%s: %v", name, err)
+        }
+        return buffer.String(), nil
+}
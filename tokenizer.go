@@ -0,0 +1,65 @@
+package main
+
+import (
+        "fmt"
+        "unicode"
+)
+
+// Tokenizer estimates how many model tokens a piece of text will use
+type Tokenizer interface {
+        Estimate(text string) int
+}
+
+// CharDivTokenizer is a very rough estimate (1 token ≈ 4 characters for English text)
+type CharDivTokenizer struct{}
+
+func (CharDivTokenizer) Estimate(text string) int {
+        return len(text) / 4
+}
+
+// WordPunctTokenizer counts runs of letters/digits and runs of punctuation
+// separately, which tracks real tokenizers much better on log lines full of
+// symbols. Long alphanumeric runs such as hex IDs rarely map to one token, so
+// they count as one token per 4 characters.
+type WordPunctTokenizer struct{}
+
+func (WordPunctTokenizer) Estimate(text string) int {
+        tokens := 0
+        wordLen := 0
+        inPunct := false
+        flushWord := func() {
+                if wordLen > 0 {
+                        tokens += (wordLen + 3) / 4
+                        wordLen = 0
+                }
+        }
+        for _, r := range text {
+                switch {
+                case unicode.IsLetter(r) || unicode.IsDigit(r):
+                        wordLen++
+                        inPunct = false
+                case unicode.IsSpace(r):
+                        flushWord()
+                        inPunct = false
+                default:
+                        flushWord()
+                        if !inPunct {
+                                tokens++
+                                inPunct = true
+                        }
+                }
+        }
+        flushWord()
+        return tokens
+}
+
+// newTokenizer returns the tokenizer selected with -tokenizer
+func newTokenizer(name string) (Tokenizer, error) {
+        switch name {
+        case "chardiv":
+                return CharDivTokenizer{}, nil
+        case "wordpunct":
+                return WordPunctTokenizer{}, nil
+        }
+        return nil, fmt.Errorf("unknown tokenizer %q (want chardiv or wordpunct)", name)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+        "fmt"
+        "regexp"
+        "strings"
+)
+
+// Transformations applied to the filtered log lines before chunking
+
+// normalizePatterns lists everything normalizeLine masks, in the order applied.
+// More specific patterns come first so e.g. the digits of an IP address are
+// not masked as plain numbers.
+var normalizePatterns = []struct {
+        pattern *regexp.Regexp
+        token   string
+}{
+        {regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), "<UUID>"},
+        {regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "<IP>"},
+        {regexp.MustCompile(`\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`), "<IP>"},
+        {regexp.MustCompile(`\b(?:[0-9a-fA-F]{1,4}:)+:[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{1,4})*|::[0-9a-fA-F]{1,4}(?::[0-9a-fA-F]{1,4})*`), "<IP>"},
+        {regexp.MustCompile(`\d+`), "<NUM>"},
+}
+
+// normalizeLine masks UUIDs, IP addresses and numbers so lines describing the
+// same kind of event look alike. The leading timestamp is left untouched.
+func normalizeLine(line string) string {
+        _, message, _ := splitLogTimestamp(line)
+        prefix := line[:len(line)-len(message)]
+        return prefix + normalizeMessage(message)
+}
+
+func normalizeMessage(message string) string {
+        for _, p := range normalizePatterns {
+                message = p.pattern.ReplaceAllString(message, p.token)
+        }
+        return message
+}
+
+// dedupLines collapses repeated log lines into their first occurrence and
+// records the repeat count on it. Lines are compared without their timestamp;
+// when normalized is set they are compared by normalizeLine's template, so
+// lines differing only in IDs or counters collapse too. Lines from different
+// sources are never merged, and -context-lines context is left in place so it
+// stays next to the line it belongs to. Returns the collapsed entries and how
+// many lines were removed.
+func dedupLines(entries []logEntry, normalized bool) ([]logEntry, int) {
+        index := make(map[string]int) // Key -> position of the representative in deduped
+        var deduped []logEntry
+        for _, entry := range entries {
+                if entry.Context {
+                        entry.Count = 1
+                        deduped = append(deduped, entry)
+                        continue
+                }
+                _, message, _ := splitLogTimestamp(entry.Text)
+                key := strings.TrimSpace(message)
+                if normalized {
+                        key = normalizeMessage(key)
+                }
+                key = entry.Source + "\x00" + key
+
+                if i, ok := index[key]; ok {
+                        deduped[i].Count++
+                        continue
+                }
+                index[key] = len(deduped)
+                entry.Count = 1
+                deduped = append(deduped, entry)
+        }
+        return deduped, len(entries) - len(deduped)
+}
+
+// defaultHealthcheckPatterns recognize the usual health, readiness and
+// metrics probes for -drop-healthchecks
+var defaultHealthcheckPatterns = []string{
+        `(?i)\b(?:GET|HEAD)\s+/(?:healthz?|health[-_]?check|readyz?|livez?|readiness|liveness|ping|status|metrics)\b`,
+        `(?i)\bkube-probe/`,
+        `(?i)\bELB-HealthChecker/`,
+        `(?i)\bGoogleHC/`,
+}
+
+// healthcheckPatterns are the compiled -healthcheck-pattern expressions, or
+// the defaults
+var healthcheckPatterns []*regexp.Regexp
+
+// probeStatusPattern finds the HTTP status of a request line: after the
+// request path, HTTP version or closing quote of an access log, or a
+// status= / "status": field
+var probeStatusPattern = regexp.MustCompile(`(?i)(?:\b(?:GET|HEAD|POST)\s+/\S*(?:\s+HTTP/[\d.]+)?"?\s+|\bstatus(?:_?code)?"?\s*[=:]\s*"?)([1-5]\d\d)\b`)
+
+// isBenignHealthcheck reports whether a line is a health check that went
+// fine: it matches a health-check pattern, is below ERROR and, if it shows an
+// HTTP status, that is 2xx or 3xx. Failing probes are kept as they are.
+func isBenignHealthcheck(line string) bool {
+        if !matchesAny(healthcheckPatterns, line) || lineSeverity(line) >= severityError {
+                return false
+        }
+        if m := probeStatusPattern.FindStringSubmatch(line); m != nil {
+                return m[1][0] == '2' || m[1][0] == '3'
+        }
+        return true
+}
+
+// collapseHealthchecks replaces each run of two or more consecutive
+// health-check lines from the same source with one line counting them, which
+// keeps the first line's timestamp and shows it as an example. Unlike
+// dedupLines it only touches lines known to be benign (see
+// isBenignHealthcheck), and a run ends at the first other line so the count
+// stays where the probes happened. Returns the
+// collapsed entries and how many lines were suppressed.
+func collapseHealthchecks(entries []logEntry) ([]logEntry, int) {
+        var collapsed []logEntry
+        suppressed := 0
+        for i := 0; i < len(entries); {
+                if entries[i].Context || !isBenignHealthcheck(entries[i].Text) {
+                        collapsed = append(collapsed, entries[i])
+                        i++
+                        continue
+                }
+                end := i + 1
+                for end < len(entries) && entries[end].Source == entries[i].Source &&
+                        !entries[end].Context && isBenignHealthcheck(entries[end].Text) {
+                        end++
+                }
+                if end-i == 1 {
+                        collapsed = append(collapsed, entries[i])
+                        i++
+                        continue
+                }
+                first := entries[i]
+                first.LastLine = entries[end-1].LastLine
+                _, message, _ := splitLogTimestamp(first.Text)
+                prefix := strings.TrimRight(first.Text[:len(first.Text)-len(message)], " ")
+                first.Text = fmt.Sprintf("[%d health-check lines suppressed, e.g. %s]", end-i, strings.TrimSpace(message))
+                if prefix != "" {
+                        first.Text = prefix + " " + first.Text
+                }
+                collapsed = append(collapsed, first)
+                suppressed += end - i - 1
+                i = end
+        }
+        return collapsed, suppressed
+}
+
+// contextMarker starts lines kept by -context-lines in the text sent to the model
+const contextMarker = "[context] "
+
+// renderLine produces the text sent to the model for an entry: redacted with
+// -redact, normalized if -normalize is set, prefixed with its repeat count if
+// dedup collapsed it, marked if it is only there as -context-lines context, and
+// tagged with its source (redacted too) when several logs are merged.
+func renderLine(entry logEntry, tagSource bool) string {
+        raw := entry.Text
+        if redactions != nil {
+                raw = redactions.redactLine(raw)
+        }
+        text := raw
+        if cfg.Normalize {
+                text = normalizeLine(text)
+        }
+        if entry.Count > 1 {
+                text = fmt.Sprintf("(x%d) %s", entry.Count, text)
+                if text != raw && cfg.Normalize {
+                        // Keep one concrete example next to the template
+                        _, example, _ := splitLogTimestamp(raw)
+                        text += " [e.g." + example + "]"
+                }
+        }
+        if entry.Context {
+                text = contextMarker + text
+        }
+        if tagSource {
+                prefix := strings.ReplaceAll(cfg.SourcePrefix, "{source}", entry.Source)
+                if redactions != nil {
+                        // ssh sources carry the host name
+                        prefix = redactions.redact(prefix)
+                }
+                text = prefix + text
+        }
+        return text
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+        "strings"
+        "testing"
+)
+
+func TestRenderLineRedactsSourcePrefix(t *testing.T) {
+        savedCfg, savedRedactions := cfg, redactions
+        t.Cleanup(func() { cfg, redactions = savedCfg, savedRedactions })
+        r, err := newRedactor(nil)
+        if err != nil {
+                t.Fatal(err)
+        }
+        redactions = r
+        cfg.SourcePrefix = "[{source}] "
+        cfg.Normalize = false
+
+        entry := logEntry{Text: "ERROR disk full", Source: "db1.prod.internal:app.log", Count: 1}
+        got := renderLine(entry, true)
+        if strings.Contains(got, "prod.internal") {
+                t.Errorf("renderLine = %q, leaks the host name", got)
+        }
+        if want := "[<HOST-1>:app.log] ERROR disk full"; got != want {
+                t.Errorf("renderLine = %q, want %q", got, want)
+        }
+}
+
+func TestCollapseHealthchecksKeepsFailures(t *testing.T) {
+        saved := healthcheckPatterns
+        t.Cleanup(func() { healthcheckPatterns = saved })
+        patterns, err := compilePatterns(defaultHealthcheckPatterns)
+        if err != nil {
+                t.Fatal(err)
+        }
+        healthcheckPatterns = patterns
+
+        lines := []string{
+                "2024-01-02T15:00:00Z INFO GET /healthz 200",
+                "2024-01-02T15:00:10Z INFO GET /healthz 200",
+                "2024-01-02T15:00:20Z INFO GET /healthz 503",
+                "2024-01-02T15:00:30Z INFO GET /healthz 503",
+                `10.0.0.1 - - [02/Jan/2024:15:00:40 +0000] "GET /readyz HTTP/1.1" 500 12`,
+                "2024-01-02T15:00:50Z ERROR GET /healthz timed out",
+                "2024-01-02T15:01:00Z ERROR GET /healthz timed out",
+                "2024-01-02T15:01:10Z INFO GET /healthz 204",
+                "2024-01-02T15:01:20Z INFO GET /metrics status=200",
+        }
+        var entries []logEntry
+        for i, line := range lines {
+                entries = append(entries, logEntry{Text: line, Source: "app.log", Count: 1, Line: i + 1, LastLine: i + 1})
+        }
+        got, suppressed := collapseHealthchecks(entries)
+        if suppressed != 2 {
+                t.Errorf("suppressed = %d, want 2", suppressed)
+        }
+        want := []struct {
+                text           string
+                line, lastLine int
+        }{
+                {"2024-01-02T15:00:00Z [2 health-check lines suppressed, e.g. INFO GET /healthz 200]", 1, 2},
+                {lines[2], 3, 3},
+                {lines[3], 4, 4},
+                {lines[4], 5, 5},
+                {lines[5], 6, 6},
+                {lines[6], 7, 7},
+                {"2024-01-02T15:01:10Z [2 health-check lines suppressed, e.g. INFO GET /healthz 204]", 8, 9},
+        }
+        if len(got) != len(want) {
+                t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+        }
+        for i, w := range want {
+                if got[i].Text != w.text || got[i].Line != w.line || got[i].LastLine != w.lastLine {
+                        t.Errorf("entry %d = %q lines %d-%d, want %q lines %d-%d", i, got[i].Text, got[i].Line, got[i].LastLine, w.text, w.line, w.lastLine)
+                }
+        }
+}
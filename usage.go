@@ -0,0 +1,72 @@
+package main
+
+import (
+        "fmt"
+        "sync"
+)
+
+// usageTotals adds up the usage objects of the AI service's responses. When a
+// response has none, its tokens are estimated and counted in Estimated.
+type usageTotals struct {
+        Requests         int `json:"requests"`
+        PromptTokens     int `json:"prompt_tokens"`
+        CompletionTokens int `json:"completion_tokens"`
+        TotalTokens      int `json:"total_tokens"`
+        Estimated        int `json:"estimated_requests,omitempty"`
+}
+
+var (
+        usageMu    sync.Mutex
+        tokenUsage usageTotals
+)
+
+// recordUsage adds one response's usage, falling back to an estimate of the
+// prompt and reply when the service didn't report any
+func recordUsage(result map[string]interface{}, prompt, reply string) {
+        usageMu.Lock()
+        defer usageMu.Unlock()
+        tokenUsage.Requests++
+
+        if u, ok := result["usage"].(map[string]interface{}); ok {
+                promptTokens, _ := u["prompt_tokens"].(float64)
+                completionTokens, _ := u["completion_tokens"].(float64)
+                totalTokens, hasTotal := u["total_tokens"].(float64)
+                if !hasTotal {
+                        totalTokens = promptTokens + completionTokens
+                }
+                tokenUsage.PromptTokens += int(promptTokens)
+                tokenUsage.CompletionTokens += int(completionTokens)
+                tokenUsage.TotalTokens += int(totalTokens)
+                return
+        }
+
+        var tok CharDivTokenizer
+        promptTokens, completionTokens := tok.Estimate(prompt), tok.Estimate(reply)
+        tokenUsage.PromptTokens += promptTokens
+        tokenUsage.CompletionTokens += completionTokens
+        tokenUsage.TotalTokens += promptTokens + completionTokens
+        tokenUsage.Estimated++
+}
+
+// currentUsage returns the totals so far
+func currentUsage() usageTotals {
+        usageMu.Lock()
+        defer usageMu.Unlock()
+        return tokenUsage
+}
+
+// resetUsage starts a new count, e.g. for each -follow cycle
+func resetUsage() {
+        usageMu.Lock()
+        defer usageMu.Unlock()
+        tokenUsage = usageTotals{}
+}
+
+func (u usageTotals) String() string {
+        s := fmt.Sprintf("%d tokens (%d prompt, %d completion) over %d requests",
+                u.TotalTokens, u.PromptTokens, u.CompletionTokens, u.Requests)
+        if u.Estimated > 0 {
+                s += fmt.Sprintf(", estimated for the %d responses that reported no usage", u.Estimated)
+        }
+        return s
+}
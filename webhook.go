@@ -0,0 +1,97 @@
+package main
+
+import (
+        "bytes"
+        "encoding/json"
+        "fmt"
+        "io"
+        "net/http"
+        "strings"
+        "text/template"
+)
+
+// Default -webhook-template: the {"text": ...} payload Slack and Discord
+// incoming webhooks both accept
+const defaultWebhookTemplate = `{"text": {{json .Text}}}`
+
+// Default -webhook-max, Discord's message limit (Slack allows more)
+const defaultWebhookMax = 2000
+
+// webhookData is what -webhook-template is executed with, once per message
+type webhookData struct {
+        Text  string
+        Part  int // 1-based
+        Parts int
+}
+
+var webhookTemplate *template.Template
+
+func loadWebhookTemplate(text string) error {
+        tmpl, err := template.New("-webhook-template").Funcs(template.FuncMap{
+                "json": func(v interface{}) (string, error) {
+                        data, err := json.Marshal(v)
+                        return string(data), err
+                },
+        }).Parse(text)
+        if err != nil {
+                return err
+        }
+        webhookTemplate = tmpl
+        return nil
+}
+
+// postWebhook sends the summary to -webhook-url, split into messages of at
+// most -webhook-max characters. It stops at the first message that fails.
+func postWebhook(summary string) error {
+        client := &http.Client{Timeout: cfg.Timeout}
+        parts := splitMessage(summary, cfg.WebhookMax)
+        for i, part := range parts {
+                var payload bytes.Buffer
+                if err := webhookTemplate.Execute(&payload, webhookData{Text: part, Part: i + 1, Parts: len(parts)}); err != nil {
+                        return fmt.Errorf("rendering -webhook-template: %v", err)
+                }
+
+                resp, err := client.Post(cfg.WebhookURL, "application/json", &payload)
+                if err != nil {
+                        return err
+                }
+                body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+                resp.Body.Close()
+                if resp.StatusCode < 200 || resp.StatusCode > 299 {
+                        err := fmt.Errorf("status %d after %d of %d messages", resp.StatusCode, i, len(parts))
+                        if detail := strings.TrimSpace(string(body)); detail != "" {
+                                err = fmt.Errorf("%v: %s", err, detail)
+                        }
+                        return err
+                }
+        }
+        logInfof("Posted the summary to the webhook (%d messages)", len(parts))
+        return nil
+}
+
+// splitMessage breaks text into pieces of at most max characters, preferring
+// to break between lines
+func splitMessage(text string, max int) []string {
+        var parts []string
+        var current strings.Builder
+        flush := func() {
+                if current.Len() > 0 {
+                        parts = append(parts, strings.TrimRight(current.String(), "\n"))
+                        current.Reset()
+                }
+        }
+        for _, line := range strings.SplitAfter(text, "\n") {
+                for len([]rune(line)) > max {
+                        flush()
+                        runes := []rune(line)
+                        parts = append(parts, string(runes[:max]))
+                        line = string(runes[max:])
+                }
+                if len([]rune(current.String()))+len([]rune(line)) > max {
+                        flush()
+                }
+                current.WriteString(line)
+        }
+        flush()
+        return parts
+}